@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
 	"github.com/unagex/kondense/pkg/controller"
@@ -10,40 +16,150 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
+const (
+	// ModeSidecar resizes the containers of the pod kondense runs in.
+	ModeSidecar = "sidecar"
+	// ModeOperator resizes the containers of the selected pods of the cluster.
+	ModeOperator = "operator"
+	// ModeAgent resizes the containers of the selected pods of the node, reading their cgroups from the host.
+	ModeAgent = "agent"
+)
+
 func main() {
-	// get pod name and namespace.
-	name := os.Getenv("HOSTNAME")
-	namespaceByte, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		log.Fatal().Err(err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		case "webhook":
+			os.Exit(serveWebhook(os.Args[2:]))
+		}
 	}
-	namespace := string(namespaceByte)
 
-	client, err := utils.GetClient()
+	config, err := utils.GetConfig()
 	if err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("failed to get kubernetes config")
 	}
-	rawClient, err := utils.GetRawClient()
+	client, err := utils.GetClient(config)
 	if err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("failed to create kubernetes client")
 	}
-
-	bt, err := utils.GetBearerToken()
+	mode := os.Getenv("MODE")
+	statsSource := os.Getenv("STATS_SOURCE")
+	if mode == ModeOperator && statsSource == "" {
+		// the operator runs outside of the pods, it can't read their cgroups.
+		statsSource = controller.StatsSourceExec
+	}
+	cgroupRoot := os.Getenv("CGROUP_ROOT")
+	if mode == ModeAgent && cgroupRoot == "" {
+		cgroupRoot = controller.DefaultHostCgroupRoot
+	}
+	var name, namespace, self string
+	if mode == "" || mode == ModeSidecar {
+		// get pod name and namespace.
+		name = os.Getenv("HOSTNAME")
+		namespaceByte, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to read namespace")
+		}
+		namespace = string(namespaceByte)
+		self = namespace + "/" + name
+	}
+	source, err := controller.NewStatsSource(statsSource, config, client, cgroupRoot, self)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to get k8s bearer token")
+		log.Fatal().Err(err).Msg("failed to create stats source")
+	}
+
+	var reconcile func(context.Context) error
+	var healthz, readyz http.HandlerFunc
+	switch mode {
+	case "", ModeSidecar:
+		reconciler := &controller.Reconciler{
+			Client:   client,
+			Recorder: utils.GetRecorder(client),
+
+			Source:    source,
+			ConfigDir: os.Getenv("CONFIG_DIR"),
+			StateFile: os.Getenv("STATE_FILE"),
+
+			Name:      name,
+			Namespace: namespace,
+		}
+		reconcile, healthz, readyz = reconciler.Reconcile, reconciler.Healthz, reconciler.Readyz
+	case ModeOperator:
+		operator := &controller.Operator{
+			Client:   client,
+			Recorder: utils.GetRecorder(client),
+
+			Source:    source,
+			ConfigDir: os.Getenv("CONFIG_DIR"),
+			StateDir:  os.Getenv("STATE_DIR"),
+
+			Namespace: os.Getenv("WATCH_NAMESPACE"),
+			Selector:  os.Getenv("SELECTOR"),
+		}
+		reconcile, healthz, readyz = operator.Reconcile, operator.Healthz, operator.Readyz
+	case ModeAgent:
+		nodeName := os.Getenv("NODE_NAME")
+		if nodeName == "" {
+			log.Fatal().Msg("error NODE_NAME should be set in agent mode")
+		}
+		operator := &controller.Operator{
+			Client:   client,
+			Recorder: utils.GetRecorder(client),
+
+			Source:    source,
+			ConfigDir: os.Getenv("CONFIG_DIR"),
+			StateDir:  os.Getenv("STATE_DIR"),
+
+			Namespace: os.Getenv("WATCH_NAMESPACE"),
+			Selector:  os.Getenv("SELECTOR"),
+			NodeName:  nodeName,
+		}
+		reconcile, healthz, readyz = operator.Reconcile, operator.Healthz, operator.Readyz
+	default:
+		log.Fatal().Msgf("error unknown mode: %s, want one of: %s, %s, %s", mode, ModeSidecar, ModeOperator, ModeAgent)
 	}
 
-	reconciler := controller.Reconciler{
-		Client:    client,
-		RawClient: rawClient,
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		BearerToken: bt,
+	metricsAddr := fmt.Sprintf(":%d", controller.MetricsPort)
+	if v, ok := os.LookupEnv("METRICS_ADDR"); ok {
+		metricsAddr = v
+	}
+	if metricsAddr != "0" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			err := http.ListenAndServe(metricsAddr, mux)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to serve metrics")
+			}
+		}()
+	}
 
-		Name:      name,
-		Namespace: namespace,
+	healthAddr := fmt.Sprintf(":%d", controller.HealthPort)
+	if v, ok := os.LookupEnv("HEALTH_ADDR"); ok {
+		healthAddr = v
+	}
+	if healthAddr != "0" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/healthz", healthz)
+			mux.HandleFunc("/readyz", readyz)
+			err := http.ListenAndServe(healthAddr, mux)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to serve health probes")
+			}
+		}()
 	}
 
 	log.Info().Msg("kondense started")
 
-	reconciler.Reconcile()
+	err = reconcile(ctx)
+	if err != nil {
+		// keep serving the health probes, so the kubelet sees the reconcile loop stopped.
+		log.Error().Err(err).Msg("reconcile loop stopped")
+		<-ctx.Done()
+	}
 }
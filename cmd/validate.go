@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/unagex/kondense/pkg/controller"
+)
+
+// validate checks the kondense configuration of every container of a pod manifest
+// and prints every problem. It returns the exit code of the command.
+func validate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	file := fs.String("f", "-", "pod manifest to validate, - for stdin. Deployments, StatefulSets, DaemonSets, Jobs and CronJobs are validated through their pod template.")
+	kondenseName := fs.String("container", "kondense", "name of the kondense container in the pod.")
+	configDir := fs.String("config-dir", "", "directory with the files of the kondense ConfigMap.")
+	fs.Parse(args)
+
+	var b []byte
+	var err error
+	if *file == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error cannot read manifest: %s\n", err)
+		return 1
+	}
+
+	pod, err := decodePod(b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error cannot decode manifest: %s\n", err)
+		return 1
+	}
+
+	// the containers are configured by the environment of the kondense container.
+	env := map[string]string{}
+	for _, c := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
+		if c.Name != *kondenseName {
+			continue
+		}
+		for _, e := range c.Env {
+			env[e.Name] = e.Value
+		}
+	}
+
+	reconciler := controller.Reconciler{
+		ConfigDir: *configDir,
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+	}
+	// read the config directory.
+	reconciler.WatchConfig(pod)
+
+	exclude := []string{}
+	if v, ok := env["EXCLUDE"]; ok {
+		exclude = strings.Split(v, ",")
+	}
+
+	problems := 0
+	// native sidecars are validated too, they are resized since Kubernetes 1.33.
+	for _, c := range controller.ManagedContainers(pod, true) {
+		if slices.Contains(exclude, c.Name) {
+			continue
+		}
+		_, errs := reconciler.LoadConfig(pod, c.Name)
+		for _, err := range errs {
+			fmt.Printf("container %s: %s\n", c.Name, err)
+		}
+		problems += len(errs)
+	}
+
+	if problems > 0 {
+		fmt.Printf("%d problems found\n", problems)
+		return 1
+	}
+
+	fmt.Println("configuration is valid")
+	return 0
+}
+
+// decodePod returns the pod of a manifest, or the pod template of a workload.
+func decodePod(b []byte) (*corev1.Pod, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(b, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	template := func(t corev1.PodTemplateSpec) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: t.ObjectMeta, Spec: t.Spec}
+	}
+
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return o, nil
+	case *appsv1.Deployment:
+		return template(o.Spec.Template), nil
+	case *appsv1.StatefulSet:
+		return template(o.Spec.Template), nil
+	case *appsv1.DaemonSet:
+		return template(o.Spec.Template), nil
+	case *batchv1.Job:
+		return template(o.Spec.Template), nil
+	case *batchv1.CronJob:
+		return template(o.Spec.JobTemplate.Spec.Template), nil
+	}
+
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	return nil, fmt.Errorf("unsupported kind %s", kind)
+}
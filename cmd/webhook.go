@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/unagex/kondense/pkg/webhook"
+)
+
+// serveWebhook serves the mutating admission webhook injecting the kondense sidecar. It returns the exit code of the command.
+func serveWebhook(args []string) int {
+	fs := flag.NewFlagSet("webhook", flag.ExitOnError)
+	addr := fs.String("addr", ":8443", "address of the webhook.")
+	certFile := fs.String("tls-cert", "/etc/kondense/tls/tls.crt", "TLS certificate of the webhook.")
+	keyFile := fs.String("tls-key", "/etc/kondense/tls/tls.key", "TLS key of the webhook.")
+	image := fs.String("image", webhook.DefaultImage, "image of the injected sidecar.")
+	nativeSidecar := fs.Bool("native-sidecar", true, "inject the sidecar as an init container with a restart policy of Always. Needs Kubernetes 1.29.")
+	fs.Parse(args)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", &webhook.Injector{Image: *image, NativeSidecar: *nativeSidecar})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	log.Info().Str("addr", *addr).Msg("kondense webhook started")
+
+	err := http.ListenAndServeTLS(*addr, *certFile, *keyFile, mux)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to serve webhook")
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,50 @@
+// Package cgroup parses the cgroup v2 interface files used by kondense.
+//
+// Files are parsed by key name, so unknown keys added by newer kernels are ignored
+// and missing keys are left to their zero value.
+package cgroup
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseFlatKeyed parses a flat keyed file, e.g. cpu.stat, into v.
+// v is a pointer to a struct, whose uint64 fields are filled from the key of their `cgroup` tag.
+func parseFlatKeyed(data []byte, v any) error {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	fields := make(map[string]int, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		if key, ok := rt.Field(i).Tag.Lookup("cgroup"); ok {
+			fields[key] = i
+		}
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		kv := strings.Fields(line)
+		if len(kv) != 2 {
+			return fmt.Errorf("error malformed line: %q", line)
+		}
+
+		i, ok := fields[kv[0]]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error cannot parse value of %s: %w", kv[0], err)
+		}
+		rv.Field(i).SetUint(n)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestdata returns the content of a sample cgroup file of testdata.
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("cannot read testdata %s: %s", name, err)
+	}
+
+	return b
+}
+
+func TestParseFlatKeyed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    MemoryEvents
+		wantErr bool
+	}{
+		{name: "empty", data: "", want: MemoryEvents{}},
+		{name: "unknown keys", data: "max 3\nnew_event 7\n", want: MemoryEvents{Max: 3}},
+		{name: "blank lines", data: "\noom 1\n\n", want: MemoryEvents{OOM: 1}},
+		{name: "malformed line", data: "oom 1 2\n", wantErr: true},
+		{name: "negative value", data: "oom -1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MemoryEvents{}
+			err := parseFlatKeyed([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlatKeyed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseFlatKeyed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
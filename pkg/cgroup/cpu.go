@@ -0,0 +1,80 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CPUStat is the content of cpu.stat.
+//
+//	usage_usec 2510938
+//	user_usec 1741279
+//	system_usec 769658
+//	nr_periods 2343
+//	nr_throttled 12
+//	throttled_usec 81234
+//	nr_bursts 0
+//	burst_usec 0
+type CPUStat struct {
+	UsageUsec     uint64 `cgroup:"usage_usec"`
+	UserUsec      uint64 `cgroup:"user_usec"`
+	SystemUsec    uint64 `cgroup:"system_usec"`
+	NrPeriods     uint64 `cgroup:"nr_periods"`
+	NrThrottled   uint64 `cgroup:"nr_throttled"`
+	ThrottledUsec uint64 `cgroup:"throttled_usec"`
+	NrBursts      uint64 `cgroup:"nr_bursts"`
+	BurstUsec     uint64 `cgroup:"burst_usec"`
+}
+
+// ParseCPUStat parses the content of cpu.stat.
+func ParseCPUStat(data []byte) (CPUStat, error) {
+	stat := CPUStat{}
+	err := parseFlatKeyed(data, &stat)
+	return stat, err
+}
+
+// CPUMax is the content of cpu.max.
+//
+//	100000 100000
+//	max 100000
+type CPUMax struct {
+	// Quota is the cpu time in microseconds the cgroup can use each period. It is -1 when there is no limit.
+	Quota int64
+	// Period is the length of a period in microseconds.
+	Period uint64
+}
+
+// ParseCPUMax parses the content of cpu.max.
+func ParseCPUMax(data []byte) (CPUMax, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return CPUMax{}, fmt.Errorf("error malformed cpu.max: %q", data)
+	}
+
+	cpuMax := CPUMax{Quota: -1}
+	if fields[0] != "max" {
+		quota, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return CPUMax{}, fmt.Errorf("error cannot parse cpu.max quota: %w", err)
+		}
+		cpuMax.Quota = quota
+	}
+
+	period, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return CPUMax{}, fmt.Errorf("error cannot parse cpu.max period: %w", err)
+	}
+	cpuMax.Period = period
+
+	return cpuMax, nil
+}
+
+// MilliCPU returns the limit in millicpus, or -1 when there is no limit.
+func (c CPUMax) MilliCPU() int64 {
+	if c.Quota < 0 || c.Period == 0 {
+		return -1
+	}
+
+	return c.Quota * 1000 / int64(c.Period)
+}
@@ -0,0 +1,84 @@
+package cgroup
+
+import (
+	"testing"
+)
+
+func TestParseCPUStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    CPUStat
+		wantErr bool
+	}{
+		{
+			name: "throttled",
+			data: readTestdata(t, "cpu.stat"),
+			want: CPUStat{
+				UsageUsec:     2510938,
+				UserUsec:      1741279,
+				SystemUsec:    769658,
+				NrPeriods:     2343,
+				NrThrottled:   12,
+				ThrottledUsec: 81234,
+			},
+		},
+		{
+			// without a cpu limit, the kernel doesn't report the throttling fields.
+			name: "without throttling fields",
+			data: readTestdata(t, "cpu.stat.unlimited"),
+			want: CPUStat{
+				UsageUsec:  2510938,
+				UserUsec:   1741279,
+				SystemUsec: 769658,
+			},
+		},
+		{name: "malformed value", data: []byte("usage_usec 1.5\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCPUStat(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCPUStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseCPUStat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCPUMax(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		want      CPUMax
+		wantMilli int64
+		wantErr   bool
+	}{
+		{name: "limited", data: readTestdata(t, "cpu.max"), want: CPUMax{Quota: 50000, Period: 100000}, wantMilli: 500},
+		{name: "unlimited", data: readTestdata(t, "cpu.max.unlimited"), want: CPUMax{Quota: -1, Period: 100000}, wantMilli: -1},
+		{name: "missing period", data: []byte("max\n"), wantErr: true},
+		{name: "malformed quota", data: []byte("half 100000\n"), wantErr: true},
+		{name: "malformed period", data: []byte("50000 -1\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCPUMax(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCPUMax() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseCPUMax() = %+v, want %+v", got, tt.want)
+			}
+			if milli := got.MilliCPU(); milli != tt.wantMilli {
+				t.Errorf("MilliCPU() = %d, want %d", milli, tt.wantMilli)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MemoryStat is the content of memory.stat. Only the keys used to size containers are kept.
+//
+//	anon 1245184
+//	file 4096000
+//	kernel 557056
+//	...
+//	inactive_file 2048000
+//	active_file 2048000
+//	...
+type MemoryStat struct {
+	Anon                  uint64 `cgroup:"anon"`
+	File                  uint64 `cgroup:"file"`
+	Kernel                uint64 `cgroup:"kernel"`
+	KernelStack           uint64 `cgroup:"kernel_stack"`
+	Sock                  uint64 `cgroup:"sock"`
+	Shmem                 uint64 `cgroup:"shmem"`
+	FileMapped            uint64 `cgroup:"file_mapped"`
+	FileDirty             uint64 `cgroup:"file_dirty"`
+	FileWriteback         uint64 `cgroup:"file_writeback"`
+	InactiveAnon          uint64 `cgroup:"inactive_anon"`
+	ActiveAnon            uint64 `cgroup:"active_anon"`
+	InactiveFile          uint64 `cgroup:"inactive_file"`
+	ActiveFile            uint64 `cgroup:"active_file"`
+	Unevictable           uint64 `cgroup:"unevictable"`
+	Slab                  uint64 `cgroup:"slab"`
+	WorkingsetRefaultFile uint64 `cgroup:"workingset_refault_file"`
+	Pgfault               uint64 `cgroup:"pgfault"`
+	Pgmajfault            uint64 `cgroup:"pgmajfault"`
+}
+
+// ParseMemoryStat parses the content of memory.stat.
+func ParseMemoryStat(data []byte) (MemoryStat, error) {
+	stat := MemoryStat{}
+	err := parseFlatKeyed(data, &stat)
+	return stat, err
+}
+
+// ParseMemoryCurrent parses the content of memory.current, the memory usage of the cgroup in bytes.
+func ParseMemoryCurrent(data []byte) (uint64, error) {
+	current, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error cannot parse memory.current: %w", err)
+	}
+
+	return current, nil
+}
+
+// WorkingSet returns the working set of a cgroup in bytes, the memory usage without the inactive
+// page cache, like the kubelet computes it.
+func WorkingSet(current uint64, stat MemoryStat) uint64 {
+	if stat.InactiveFile > current {
+		return 0
+	}
+
+	return current - stat.InactiveFile
+}
+
+// MemoryEvents is the content of memory.events.
+//
+//	low 0
+//	high 0
+//	max 12
+//	oom 1
+//	oom_kill 1
+//	oom_group_kill 0
+type MemoryEvents struct {
+	// Low is the number of times the cgroup was reclaimed while under its low boundary.
+	Low uint64 `cgroup:"low"`
+	// High is the number of times the cgroup was throttled for going over its high boundary.
+	High uint64 `cgroup:"high"`
+	// Max is the number of times the cgroup usage was about to go over its max boundary.
+	Max uint64 `cgroup:"max"`
+	// OOM is the number of times the cgroup hit its limit and memory allocation was about to fail.
+	OOM uint64 `cgroup:"oom"`
+	// OOMKill is the number of processes killed by the OOM killer in the cgroup.
+	OOMKill uint64 `cgroup:"oom_kill"`
+	// OOMGroupKill is the number of times the whole cgroup was OOM killed.
+	OOMGroupKill uint64 `cgroup:"oom_group_kill"`
+}
+
+// ParseMemoryEvents parses the content of memory.events.
+func ParseMemoryEvents(data []byte) (MemoryEvents, error) {
+	events := MemoryEvents{}
+	err := parseFlatKeyed(data, &events)
+	return events, err
+}
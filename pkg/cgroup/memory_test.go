@@ -0,0 +1,122 @@
+package cgroup
+
+import (
+	"testing"
+)
+
+func TestParseMemoryStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    MemoryStat
+		wantErr bool
+	}{
+		{
+			name: "memory.stat",
+			data: readTestdata(t, "memory.stat"),
+			want: MemoryStat{
+				Anon:                  1245184,
+				File:                  4096000,
+				Kernel:                557056,
+				KernelStack:           49152,
+				FileMapped:            1228800,
+				FileDirty:             4096,
+				InactiveAnon:          1236992,
+				ActiveAnon:            8192,
+				InactiveFile:          2048000,
+				ActiveFile:            2048000,
+				Slab:                  406256,
+				WorkingsetRefaultFile: 17,
+				Pgfault:               4875,
+				Pgmajfault:            18,
+			},
+		},
+		{name: "malformed line", data: []byte("anon\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemoryStat(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemoryStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseMemoryStat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemoryEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    MemoryEvents
+		wantErr bool
+	}{
+		{
+			name: "memory.events",
+			data: readTestdata(t, "memory.events"),
+			want: MemoryEvents{Max: 12, OOM: 1, OOMKill: 1},
+		},
+		{name: "malformed value", data: []byte("oom_kill x\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemoryEvents(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemoryEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseMemoryEvents() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemoryCurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    uint64
+		wantErr bool
+	}{
+		{name: "memory.current", data: readTestdata(t, "memory.current"), want: 5898240},
+		{name: "empty", data: []byte(""), wantErr: true},
+		{name: "malformed", data: []byte("max\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemoryCurrent(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemoryCurrent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMemoryCurrent() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkingSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		current uint64
+		stat    MemoryStat
+		want    uint64
+	}{
+		{name: "without page cache", current: 5898240, stat: MemoryStat{InactiveFile: 2048000}, want: 3850240},
+		{name: "no inactive file", current: 1024, stat: MemoryStat{}, want: 1024},
+		{name: "inactive file above current", current: 1024, stat: MemoryStat{InactiveFile: 4096}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WorkingSet(tt.current, tt.stat); got != tt.want {
+				t.Errorf("WorkingSet() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PSI is the pressure stall information of a resource, read from
+// cpu.pressure, memory.pressure or io.pressure.
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=1234
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=1000
+type PSI struct {
+	// Some is the share of time some tasks were stalled on the resource.
+	Some PSILine
+	// Full is the share of time all non-idle tasks were stalled on the resource at the same time.
+	// It is zero on kernels that don't report it.
+	Full PSILine
+}
+
+// PSILine is one line of a pressure file.
+type PSILine struct {
+	// Avg10, Avg60 and Avg300 are the percentage of stalled time over the last 10, 60 and 300 seconds.
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the total stalled time in microseconds.
+	Total uint64
+}
+
+// ParsePSI parses the content of a pressure file.
+func ParsePSI(data []byte) (PSI, error) {
+	psi := PSI{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var l *PSILine
+		switch fields[0] {
+		case "some":
+			l = &psi.Some
+		case "full":
+			l = &psi.Full
+		default:
+			return PSI{}, fmt.Errorf("error unexpected pressure line: %q", line)
+		}
+
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				return PSI{}, fmt.Errorf("error malformed pressure field: %q", f)
+			}
+
+			var err error
+			switch k {
+			case "avg10":
+				l.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				l.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				l.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				l.Total, err = strconv.ParseUint(v, 10, 64)
+			}
+			if err != nil {
+				return PSI{}, fmt.Errorf("error cannot parse pressure field %s: %w", k, err)
+			}
+		}
+	}
+
+	return psi, nil
+}
@@ -0,0 +1,45 @@
+package cgroup
+
+import (
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    PSI
+		wantErr bool
+	}{
+		{
+			name: "some and full",
+			data: readTestdata(t, "memory.pressure"),
+			want: PSI{
+				Some: PSILine{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 123456},
+				Full: PSILine{Avg10: 0.5, Avg60: 0.25, Avg300: 0.1, Total: 65432},
+			},
+		},
+		{
+			name: "some only",
+			// kernels before 5.13 don't report full for cpu.
+			data: readTestdata(t, "cpu.pressure.some"),
+			want: PSI{Some: PSILine{Avg10: 2, Avg60: 1, Avg300: 0.5, Total: 5000}},
+		},
+		{name: "empty", data: []byte(""), want: PSI{}},
+		{name: "unexpected line", data: []byte("partial avg10=0.00 total=0\n"), wantErr: true},
+		{name: "malformed field", data: []byte("some avg10\n"), wantErr: true},
+		{name: "malformed total", data: []byte("some total=abc\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePSI(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePSI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePSI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/unagex/kondense/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// KondenseBurstable resizes a container of a Burstable pod. Its requests follow the working set and the average
+// cpu usage of the container, and its limits follow the requests with the limit policies, always above them,
+// so the QoS class of the pod stays Burstable.
+func (r *Reconciler) KondenseBurstable(ctx context.Context, pod *corev1.Pod, container corev1.Container) error {
+	memFactor := r.KondenseMemoryRequest(container)
+	cpuFactor := r.KondenseCPURequest(container)
+
+	metrics.MemoryFactor.WithLabelValues(r.Namespace, r.Name, container.Name).Set(memFactor)
+	metrics.CPUFactor.WithLabelValues(r.Namespace, r.Name, container.Name).Set(cpuFactor)
+
+	// without a factor, the limits are only raised when the usage got too close to them.
+	return r.AdjustBurstable(ctx, pod, container.Name, memFactor, cpuFactor)
+}
+
+// KondenseMemoryRequest returns the factor to apply to the memory request of the container to follow its working set.
+// The request is raised right away, and lowered to the peak working set of the last Interval seconds.
+func (r *Reconciler) KondenseMemoryRequest(container corev1.Container) float64 {
+	s := r.CStats[container.Name]
+	s.Mem.Signal = SignalWorkingSet
+
+	if s.Mem.Request == 0 {
+		// the container has no memory request to resize.
+		return 0
+	}
+
+	if s.Mem.OOMKilled {
+		// raise the request, and so the limit, right away after an out-of-memory kill.
+		s.Mem.OOMKilled = false
+		s.Mem.Signal = SignalOOM
+		s.Mem.GraceTicks = s.Mem.Interval - 1
+		return s.Mem.MaxInc
+	}
+
+	adj := float64(s.Mem.WorkingSet)/float64(s.Mem.Request) - 1
+	if adj > RequestTolerance {
+		s.Mem.GraceTicks = s.Mem.Interval - 1
+		return min(adj, s.Mem.MaxInc)
+	}
+
+	// lower the request when grace ticks goes to 0.
+	if s.Mem.GraceTicks > 0 {
+		s.Mem.GraceTicks -= 1
+		return 0
+	}
+
+	// don't lower the request during the cool-down following an out-of-memory kill.
+	if time.Since(s.Mem.LastOOM) < time.Duration(s.Mem.OOMCooldown)*time.Second {
+		return 0
+	}
+
+	adj = float64(s.Mem.PeakWorkingSet)/float64(s.Mem.Request) - 1
+	s.Mem.PeakWorkingSet = s.Mem.WorkingSet
+	s.Mem.GraceTicks = s.Mem.Interval - 1
+	if adj > -RequestTolerance {
+		return 0
+	}
+
+	return max(adj, -s.Mem.MaxDec)
+}
+
+// KondenseCPURequest returns the factor to apply to the cpu request of the container to follow its average cpu usage.
+func (r *Reconciler) KondenseCPURequest(container corev1.Container) float64 {
+	s := r.CStats[container.Name]
+	s.Cpu.Signal = SignalCPUAvg
+
+	// the average needs 2 probes.
+	if s.Cpu.Request == 0 || len(s.Cpu.Probes) < 2 {
+		return 0
+	}
+
+	adj := float64(s.Cpu.Avg)/float64(s.Cpu.Request) - 1
+	if math.Abs(adj) < RequestTolerance {
+		adj = 0
+	}
+	adj = min(max(adj, -s.Cpu.MaxDec), s.Cpu.MaxInc)
+
+	// a container without a cpu limit is never throttled.
+	if s.Cpu.Limit > 0 {
+		if throttleAdj := r.KondenseCPUThrottle(container); throttleAdj > adj {
+			adj = throttleAdj
+			s.Cpu.Signal = SignalThrottle
+		}
+	}
+
+	return adj
+}
+
+// AdjustBurstable applies the factors to the requests of a container of a Burstable pod and sets its limits
+// from the new requests with the limit policies. A resize can't add or remove a request or a limit, so the
+// resources without one are left as they are.
+func (r *Reconciler) AdjustBurstable(ctx context.Context, pod *corev1.Pod, containerName string, memFactor, cpuFactor float64) error {
+	s := r.CStats[containerName]
+	resources := corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{},
+		Requests: corev1.ResourceList{},
+	}
+
+	newMemRequest, newMemLimit := uint64(s.Mem.Request), uint64(s.Mem.Limit)
+	if s.Mem.Request > 0 {
+		newMemRequest = uint64(float64(s.Mem.Request) * (1 + memFactor))
+		newMemRequest = min(max(newMemRequest, s.Mem.Min), s.Mem.Max)
+		resources.Requests[corev1.ResourceMemory] = *resource.NewQuantity(int64(newMemRequest), resource.DecimalSI)
+	}
+	if s.Mem.Limit > 0 {
+		// the request converges to the working set over several ticks, the limit keeps its headroom
+		// above the working set meanwhile and is never set below the memory in use.
+		newMemLimit = max(
+			limit(newMemRequest, s.Mem.LimitPolicy, s.Mem.LimitRatio, s.Mem.LimitBuffer),
+			limit(s.Mem.WorkingSet, s.Mem.LimitPolicy, s.Mem.LimitRatio, s.Mem.LimitBuffer),
+			s.Mem.Usage,
+			s.Mem.Floor,
+		)
+		if memFactor == 0 {
+			// without a new request, the limit is only raised.
+			newMemLimit = max(newMemLimit, uint64(s.Mem.Limit))
+		}
+		resources.Limits[corev1.ResourceMemory] = *resource.NewQuantity(int64(newMemLimit), resource.DecimalSI)
+	}
+
+	newCPURequest, newCPULimit := uint64(s.Cpu.Request), uint64(s.Cpu.Limit)
+	if s.Cpu.Request > 0 {
+		newCPURequest = uint64(float64(s.Cpu.Request) * (1 + cpuFactor))
+		newCPURequest = min(max(newCPURequest, s.Cpu.Min), s.Cpu.Max)
+		resources.Requests[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(newCPURequest), resource.DecimalSI)
+	}
+	if s.Cpu.Limit > 0 {
+		// keep the headroom above the average cpu usage while the request converges.
+		newCPULimit = max(
+			limit(newCPURequest, s.Cpu.LimitPolicy, s.Cpu.LimitRatio, s.Cpu.LimitBuffer),
+			limit(s.Cpu.Avg, s.Cpu.LimitPolicy, s.Cpu.LimitRatio, s.Cpu.LimitBuffer),
+		)
+		if cpuFactor == 0 {
+			// without a new request, the limit is only raised.
+			newCPULimit = max(newCPULimit, uint64(s.Cpu.Limit))
+		}
+		resources.Limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(newCPULimit), resource.DecimalSI)
+	}
+
+	MemUpdate := newMemRequest != uint64(s.Mem.Request) || newMemLimit != uint64(s.Mem.Limit)
+	CPUUpdate := newCPURequest != uint64(s.Cpu.Request) || newCPULimit != uint64(s.Cpu.Limit)
+	if !MemUpdate && !CPUUpdate {
+		return nil
+	}
+
+	message := fmt.Sprintf("memory request %d -> %d, limit %d -> %d (%s, factor %.2f), cpu request %dm -> %dm, limit %dm -> %dm (%s, factor %.2f)",
+		s.Mem.Request, newMemRequest, s.Mem.Limit, newMemLimit, s.Mem.Signal, memFactor,
+		s.Cpu.Request, newCPURequest, s.Cpu.Limit, newCPULimit, s.Cpu.Signal, cpuFactor)
+
+	return r.applyResize(ctx, pod, containerName, resources, MemUpdate, CPUUpdate, memFactor, cpuFactor, message)
+}
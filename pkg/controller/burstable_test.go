@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdjustBurstable(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name            string
+		workingSet      uint64
+		usage           uint64
+		wantMemRequest  int64
+		wantMemLimitMin int64
+	}{
+		// the request follows the working set, the limit keeps twice the request with the default ratio.
+		{name: "growing working set", workingSet: 300_000_000, usage: 300_000_000, wantMemRequest: 150_000_000, wantMemLimitMin: 600_000_000},
+		// the limit is never set below the memory in use, even when the request is not raised.
+		{name: "usage above limit", workingSet: 60_000_000, usage: 250_000_000, wantMemRequest: 100_000_000, wantMemLimitMin: 250_000_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(200_000_000, 1000))
+			r, source := newTestReconciler(t, pod)
+			container := pod.Spec.Containers[0]
+
+			source.Set("app", Sample{MemUsage: tt.usage, MemWorkingSet: tt.workingSet, T: start})
+			if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+				t.Fatalf("UpdateStats() error = %s", err)
+			}
+
+			err := r.KondenseContainer(context.Background(), pod, container)
+			if err != nil {
+				t.Fatalf("KondenseContainer() error = %s", err)
+			}
+
+			c := patchedContainer(t, r)
+			if got := c.Resources.Requests.Memory().Value(); got != tt.wantMemRequest {
+				t.Errorf("memory request = %d, want %d", got, tt.wantMemRequest)
+			}
+			limit := c.Resources.Limits.Memory().Value()
+			if limit < tt.wantMemLimitMin || limit < int64(tt.usage) || limit < 2*int64(tt.workingSet) {
+				t.Errorf("memory limit = %d, want at least %d, the usage %d and twice the working set %d",
+					limit, tt.wantMemLimitMin, tt.usage, tt.workingSet)
+			}
+			if limit <= c.Resources.Requests.Memory().Value() {
+				t.Errorf("memory limit = %d, want above the request", limit)
+			}
+		})
+	}
+}
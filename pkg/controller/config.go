@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AnnotationPrefix is the prefix of the pod annotations configuring kondense,
+// e.g. kondense.unagex.com/nginx.memory-min.
+const AnnotationPrefix = "kondense.unagex.com/"
+
+// Config holds the settings of a container.
+type Config struct {
+	Mem MemoryConfig
+	Cpu CPUConfig
+}
+
+// lookupConfig returns the value of a setting of a container, e.g. memory-min, and where it was found.
+// The pod annotation kondense.unagex.com/<container>.<setting> takes precedence over the key
+// <container>.<setting> of the mounted ConfigMap in ConfigDir, which takes precedence over
+// the environment variable <CONTAINER>_<SETTING>, e.g. NGINX_MEMORY_MIN.
+func (r *Reconciler) lookupConfig(pod *corev1.Pod, containerName, setting string) (string, string, bool) {
+	annotation := AnnotationPrefix + containerName + "." + setting
+	if v, ok := pod.Annotations[annotation]; ok {
+		return v, "annotation " + annotation, true
+	}
+
+	key := containerName + "." + setting
+	if v, ok := r.configFiles[key]; ok {
+		return v, "config key " + key, true
+	}
+
+	env := strings.ToUpper(strings.ReplaceAll(containerName+"_"+setting, "-", "_"))
+	lookupEnv := os.LookupEnv
+	if r.LookupEnv != nil {
+		lookupEnv = r.LookupEnv
+	}
+	if v, ok := lookupEnv(env); ok {
+		return v, "environment variable " + env, true
+	}
+
+	return "", "", false
+}
+
+// WatchConfig reloads the configuration of the containers when the kondense annotations
+// of the pod or the files of ConfigDir changed since the last call.
+func (r *Reconciler) WatchConfig(pod *corev1.Pod) {
+	fingerprint := r.configFingerprint(pod)
+	if fingerprint == r.configVersion {
+		return
+	}
+	first := r.configVersion == ""
+	r.configVersion = fingerprint
+
+	r.configFiles = readConfigDir(r.ConfigDir)
+	if !first {
+		r.ReloadConfig(pod)
+	}
+}
+
+// ReloadConfig applies the current configuration of every container to its stats,
+// keeping the collected probes and integrals.
+func (r *Reconciler) ReloadConfig(pod *corev1.Pod) {
+	for name, s := range r.CStats {
+		config, errs := r.LoadConfig(pod, name)
+		r.setConfigErrors(name, errs)
+		if len(errs) > 0 {
+			// keep the current configuration.
+			continue
+		}
+
+		current := Config{Mem: s.Mem.MemoryConfig, Cpu: s.Cpu.CPUConfig}
+		if config == current {
+			continue
+		}
+
+		r.logger().Info().
+			Str("container", name).
+			Strs("changes", diffConfig(current, config)).
+			Msg("reloaded configuration")
+
+		s.Mem.MemoryConfig = config.Mem
+		s.Mem.GraceTicks = min(s.Mem.GraceTicks, config.Mem.Interval)
+		s.Cpu.CPUConfig = config.Cpu
+		s.Cpu.GraceTicks = min(s.Cpu.GraceTicks, config.Cpu.Interval)
+		if len(s.Cpu.Probes) > int(config.Cpu.Interval) {
+			// keep the newest probes.
+			s.Cpu.Probes = s.Cpu.Probes[len(s.Cpu.Probes)-int(config.Cpu.Interval):]
+		}
+	}
+}
+
+// Validate checks the settings of a container together.
+func (c Config) Validate() []error {
+	var errs []error
+	if c.Mem.Min > c.Mem.Max {
+		errs = append(errs, fmt.Errorf("error memory min %d should be smaller than memory max %d", c.Mem.Min, c.Mem.Max))
+	}
+	if c.Mem.MaxDec <= 0 || c.Mem.MaxDec >= 1 {
+		errs = append(errs, fmt.Errorf("error memory max dec should be between 0 and 1 exclusive, got %v", c.Mem.MaxDec))
+	}
+	if c.Mem.Interval == 0 {
+		errs = append(errs, fmt.Errorf("error memory interval should be bigger than 0"))
+	}
+	if c.Mem.CoeffInc == 0 || c.Mem.CoeffDec == 0 {
+		errs = append(errs, fmt.Errorf("error memory coeffs should be bigger than 0"))
+	}
+	if c.Mem.Policy == MemoryPolicyPID && c.Mem.PIDKp == 0 && c.Mem.PIDKi == 0 && c.Mem.PIDKd == 0 {
+		errs = append(errs, fmt.Errorf("error memory pid gains should not all be 0"))
+	}
+	if c.Cpu.Min > c.Cpu.Max {
+		errs = append(errs, fmt.Errorf("error cpu min %dm should be smaller than cpu max %dm", c.Cpu.Min, c.Cpu.Max))
+	}
+	if c.Cpu.MaxDec <= 0 || c.Cpu.MaxDec >= 1 {
+		errs = append(errs, fmt.Errorf("error cpu max dec should be between 0 and 1 exclusive, got %v", c.Cpu.MaxDec))
+	}
+	if c.Cpu.Interval < 2 {
+		// the cpu average needs 2 probes.
+		errs = append(errs, fmt.Errorf("error cpu interval should be at least 2, got %d", c.Cpu.Interval))
+	}
+	if c.Cpu.Coeff == 0 {
+		errs = append(errs, fmt.Errorf("error cpu coeff should be bigger than 0"))
+	}
+
+	return errs
+}
+
+// ValidateBurstable checks the settings of a container of a Burstable pod. Its requests follow its working set
+// and average cpu usage, so the policies and predictive scaling of Guaranteed pods can't be set.
+func (c Config) ValidateBurstable() []error {
+	var errs []error
+	if c.Mem.Policy != DefaultMemPolicy {
+		errs = append(errs, fmt.Errorf("error memory policy %s is not supported in Burstable pods", c.Mem.Policy))
+	}
+	if c.Cpu.Policy != DefaultCPUPolicy {
+		errs = append(errs, fmt.Errorf("error cpu policy %s is not supported in Burstable pods", c.Cpu.Policy))
+	}
+	if c.Mem.Predictive || c.Cpu.Predictive {
+		errs = append(errs, fmt.Errorf("error predictive scaling is not supported in Burstable pods"))
+	}
+
+	return errs
+}
+
+// setConfigErrors records the problems of the configuration of a container. A container with
+// problems is not kondensed and kondense is not ready until they are fixed.
+func (r *Reconciler) setConfigErrors(containerName string, errs []error) {
+	if r.configErrors == nil {
+		r.configErrors = map[string][]error{}
+	}
+
+	if len(errs) == 0 {
+		delete(r.configErrors, containerName)
+		return
+	}
+
+	r.configErrors[containerName] = errs
+	for _, err := range errs {
+		r.logger().Error().Err(err).Str("container", containerName).Msg("invalid configuration")
+	}
+}
+
+// configFingerprint changes when the kondense annotations of the pod or the files of ConfigDir change.
+func (r *Reconciler) configFingerprint(pod *corev1.Pod) string {
+	var b strings.Builder
+
+	keys := []string{}
+	for k := range pod.Annotations {
+		if strings.HasPrefix(k, AnnotationPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, pod.Annotations[k])
+	}
+
+	if r.ConfigDir != "" {
+		// a ConfigMap update atomically swaps the ..data symlink of the mounted directory.
+		if fi, err := os.Stat(r.ConfigDir); err == nil {
+			fmt.Fprintf(&b, "%s\n", fi.ModTime())
+		}
+	}
+
+	// never empty, so the first call is always a change.
+	return "config\n" + b.String()
+}
+
+// readConfigDir reads the files of a mounted ConfigMap, keyed by file name.
+func readConfigDir(dir string) map[string]string {
+	files := map[string]string{}
+	if dir == "" {
+		return files
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("failed to read config directory")
+		return files
+	}
+
+	for _, e := range entries {
+		// skip the ..data symlink and the timestamped directories of the ConfigMap.
+		if strings.HasPrefix(e.Name(), "..") || e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			log.Error().Err(err).Str("file", e.Name()).Msg("failed to read config file")
+			continue
+		}
+		files[e.Name()] = strings.TrimSpace(string(b))
+	}
+
+	return files
+}
+
+// diffConfig returns the settings that changed between old and new, e.g. "memory.Min: 50000000 -> 100000000".
+func diffConfig(old, new Config) []string {
+	changes := []string{}
+	changes = append(changes, diffStruct("memory", reflect.ValueOf(old.Mem), reflect.ValueOf(new.Mem))...)
+	changes = append(changes, diffStruct("cpu", reflect.ValueOf(old.Cpu), reflect.ValueOf(new.Cpu))...)
+
+	return changes
+}
+
+func diffStruct(prefix string, old, new reflect.Value) []string {
+	changes := []string{}
+	for i := 0; i < old.NumField(); i++ {
+		o, n := old.Field(i).Interface(), new.Field(i).Interface()
+		if o != n {
+			changes = append(changes, fmt.Sprintf("%s.%s: %v -> %v", prefix, old.Type().Field(i).Name, o, n))
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfigDir replaces the files of a mounted ConfigMap and moves its modification time to t,
+// like the kubelet swapping the ..data symlink of the directory.
+func writeConfigDir(t *testing.T, dir string, files map[string]string, mtime time.Time) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+	writeConfigDir(t, dir, map[string]string{"app.memory-min": "50000000", "app.cpu-interval": "6"}, start)
+
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, _ := newTestReconciler(t, pod)
+	r.ConfigDir = dir
+	r.WatchConfig(pod)
+	r.CStats = ContainerStats{}
+	r.InitCStats(pod)
+
+	s := r.CStats["app"]
+	s.Mem.Integral = 2_000
+	s.Mem.LastOOM = start
+	s.Cpu.GraceTicks = 5
+	for i := 0; i < 6; i++ {
+		s.Cpu.Probes = append(s.Cpu.Probes, Probe{Total: uint64(i), T: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	tests := []struct {
+		name         string
+		files        map[string]string
+		annotations  map[string]string
+		wantMin      uint64
+		wantInterval uint64
+		wantErr      bool
+	}{
+		{name: "changed key", files: map[string]string{"app.memory-min": "60000000", "app.cpu-interval": "6"}, wantMin: 60_000_000, wantInterval: 6},
+		// an invalid configuration is reported and the previous one is kept.
+		{name: "invalid value", files: map[string]string{"app.memory-min": "sixty", "app.cpu-interval": "6"}, wantMin: 60_000_000, wantInterval: 6, wantErr: true},
+		{name: "invalid combination", files: map[string]string{"app.memory-min": "70000000", "app.memory-max": "60000000", "app.cpu-interval": "6"}, wantMin: 60_000_000, wantInterval: 6, wantErr: true},
+		{name: "fixed configuration", files: map[string]string{"app.memory-min": "70000000", "app.cpu-interval": "6"}, wantMin: 70_000_000, wantInterval: 6},
+		// the annotations take precedence over the ConfigMap.
+		{name: "annotation", files: map[string]string{"app.memory-min": "70000000", "app.cpu-interval": "6"},
+			annotations: map[string]string{AnnotationPrefix + "app.memory-min": "80000000"}, wantMin: 80_000_000, wantInterval: 6},
+		{name: "shorter interval", files: map[string]string{"app.memory-min": "70000000", "app.cpu-interval": "3"},
+			annotations: map[string]string{AnnotationPrefix + "app.memory-min": "80000000"}, wantMin: 80_000_000, wantInterval: 3},
+	}
+
+	for i, tt := range tests {
+		writeConfigDir(t, dir, tt.files, start.Add(time.Duration(i+1)*time.Second))
+		pod.Annotations = tt.annotations
+		r.WatchConfig(pod)
+
+		s := r.CStats["app"]
+		if s.Mem.Min != tt.wantMin || s.Cpu.Interval != tt.wantInterval {
+			t.Errorf("%s: memory min = %d, cpu interval = %d, want %d, %d", tt.name, s.Mem.Min, s.Cpu.Interval, tt.wantMin, tt.wantInterval)
+		}
+		if errs := r.configErrors["app"]; (len(errs) > 0) != tt.wantErr {
+			t.Errorf("%s: configuration errors = %v, want errors %t", tt.name, errs, tt.wantErr)
+		}
+	}
+
+	// the stats collected before the reloads are kept, the probes and grace ticks fit the new interval.
+	s = r.CStats["app"]
+	if s.Mem.Integral != 2_000 || !s.Mem.LastOOM.Equal(start) {
+		t.Errorf("integral = %d, last out-of-memory kill = %s, want 2000, %s", s.Mem.Integral, s.Mem.LastOOM, start)
+	}
+	if len(s.Cpu.Probes) != 3 || s.Cpu.Probes[0].Total != 3 {
+		t.Errorf("probes = %v, want the 3 newest", s.Cpu.Probes)
+	}
+	if s.Cpu.GraceTicks != 3 {
+		t.Errorf("grace ticks = %d, want %d", s.Cpu.GraceTicks, 3)
+	}
+}
+
+func TestWatchConfigUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+	writeConfigDir(t, dir, map[string]string{"app.memory-min": "60000000"}, start)
+
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, _ := newTestReconciler(t, pod)
+	r.ConfigDir = dir
+	r.WatchConfig(pod)
+	r.CStats = ContainerStats{}
+	r.InitCStats(pod)
+
+	// the files are read again only when the ConfigMap or the annotations changed.
+	if err := os.WriteFile(filepath.Join(dir, "app.memory-min"), []byte("70000000"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, start, start); err != nil {
+		t.Fatal(err)
+	}
+	r.WatchConfig(pod)
+	if got := r.CStats["app"].Mem.Min; got != 60_000_000 {
+		t.Errorf("memory min = %d, want %d", got, 60_000_000)
+	}
+
+	pod.Annotations = map[string]string{AnnotationPrefix + "app.cpu-min": "100m"}
+	r.WatchConfig(pod)
+	s := r.CStats["app"]
+	if s.Mem.Min != 70_000_000 || s.Cpu.Min != 100 {
+		t.Errorf("memory min = %d, cpu min = %d, want %d, %d", s.Mem.Min, s.Cpu.Min, 70_000_000, 100)
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerName is the name of the kondense container in a pod.
+const ContainerName = "kondense"
+
+// IsSidecar returns true when the container is a native sidecar, i.e. an init container
+// with a restart policy of Always running for the whole life of the pod.
+func IsSidecar(c corev1.Container) bool {
+	return c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// isKondense returns true when the container is kondense itself.
+func isKondense(containerName string) bool {
+	return strings.ToLower(containerName) == ContainerName
+}
+
+// isSelf returns true when the container is the kondense container reading the stats, i.e. the sidecar of the
+// pod self, named namespace/name. self is empty outside of sidecar mode, where kondense runs in its own pod.
+func isSelf(self string, pod *corev1.Pod, containerName string) bool {
+	return self != "" && self == pod.Namespace+"/"+pod.Name && isKondense(containerName)
+}
+
+// ManagedContainers returns the containers of the pod kondense can resize: the containers and, when the API server
+// has the pods/resize subresource and so can resize them, the native sidecars.
+func ManagedContainers(pod *corev1.Pod, resizeSubresource bool) []corev1.Container {
+	containers := append([]corev1.Container{}, pod.Spec.Containers...)
+	if !resizeSubresource {
+		// native sidecars can only be resized since Kubernetes 1.33.
+		return containers
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if IsSidecar(c) {
+			containers = append(containers, c)
+		}
+	}
+
+	return containers
+}
+
+// containerStatus returns the status of a container or of an init container of the pod.
+func containerStatus(pod *corev1.Pod, containerName string) (corev1.ContainerStatus, bool) {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+		for _, cs := range statuses {
+			if cs.Name == containerName {
+				return cs, true
+			}
+		}
+	}
+
+	return corev1.ContainerStatus{}, false
+}
+
+// isInitContainer returns true when the container is an init container of the pod, e.g. a native sidecar.
+func isInitContainer(pod *corev1.Pod, containerName string) bool {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == containerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// completed returns true when the containers of a pod that is not restarted exited, e.g. the containers of a Job.
+// Kondense itself and the native sidecars are not waited for.
+func completed(pod *corev1.Pod) bool {
+	if pod.Spec.RestartPolicy == corev1.RestartPolicyAlways || pod.Spec.RestartPolicy == "" {
+		return false
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if isKondense(c.Name) {
+			continue
+		}
+		cs, ok := containerStatus(pod, c.Name)
+		if !ok || cs.State.Terminated == nil {
+			return false
+		}
+		if pod.Spec.RestartPolicy == corev1.RestartPolicyOnFailure && cs.State.Terminated.ExitCode != 0 {
+			// the container will be restarted.
+			return false
+		}
+	}
+
+	return true
+}
+
+// QOSClass returns the QoS class of the pod. It is computed from the resources of the containers when the pod
+// has no status yet, e.g. a manifest being validated.
+func QOSClass(pod *corev1.Pod) corev1.PodQOSClass {
+	if pod.Status.QOSClass != "" {
+		return pod.Status.QOSClass
+	}
+
+	guaranteed, bestEffort := true, true
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			request, hasRequest := c.Resources.Requests[name]
+			limit, hasLimit := c.Resources.Limits[name]
+			if hasRequest || hasLimit {
+				bestEffort = false
+			}
+			// the API server defaults requests to limits.
+			if !hasLimit || (hasRequest && request.Cmp(limit) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+
+	switch {
+	case bestEffort:
+		return corev1.PodQOSBestEffort
+	case guaranteed:
+		return corev1.PodQOSGuaranteed
+	}
+	return corev1.PodQOSBurstable
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testPod returns a running pod with one container app, with these requests and limits.
+// The pod is Guaranteed when limits equal requests, and Burstable otherwise.
+func testPod(requests, limits corev1.ResourceList) *corev1.Pod {
+	qos := corev1.PodQOSGuaranteed
+	if limits.Memory().Cmp(*requests.Memory()) != 0 || limits.Cpu().Cmp(*requests.Cpu()) != 0 {
+		qos = corev1.PodQOSBurstable
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:      "app",
+				Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits},
+			}},
+		},
+		Status: corev1.PodStatus{
+			QOSClass: qos,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:               "app",
+				ContainerID:        "containerd://app",
+				State:              corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				AllocatedResources: requests,
+			}},
+		},
+	}
+}
+
+// resources returns a resource list of memory bytes and cpu millicpus.
+func resources(memory, cpu int64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceMemory: *resource.NewQuantity(memory, resource.DecimalSI),
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+	}
+}
+
+// newTestReconciler returns a reconciler of the pod with a fake client and a FakeSource, its stats initialized
+// with the default configuration.
+func newTestReconciler(t *testing.T, pod *corev1.Pod) (*Reconciler, *FakeSource) {
+	t.Helper()
+
+	source := &FakeSource{}
+	r := &Reconciler{
+		Client:    fake.NewSimpleClientset(pod.DeepCopy()),
+		Source:    source,
+		LookupEnv: func(string) (string, bool) { return "", false },
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		CStats:    ContainerStats{},
+	}
+	r.InitCStats(pod)
+	if len(r.configErrors["app"]) > 0 {
+		t.Fatalf("unexpected configuration errors: %v", r.configErrors["app"])
+	}
+
+	return r, source
+}
+
+// patchedContainer returns the container app of the pod in the fake client.
+func patchedContainer(t *testing.T, r *Reconciler) corev1.Container {
+	t.Helper()
+
+	pod, err := r.Client.CoreV1().Pods(r.Namespace).Get(context.Background(), r.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("cannot get pod: %s", err)
+	}
+
+	return pod.Spec.Containers[0]
+}
+
+// patchedLimit returns the memory limit of the container app of the pod in the fake client.
+func patchedLimit(t *testing.T, r *Reconciler) int64 {
+	t.Helper()
+
+	c := patchedContainer(t, r)
+	return c.Resources.Limits.Memory().Value()
+}
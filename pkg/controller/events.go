@@ -0,0 +1,22 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the events recorded on the pod.
+const (
+	ReasonResized          = "Resized"
+	ReasonResizeFailed     = "ResizeFailed"
+	ReasonResizeInfeasible = "ResizeInfeasible"
+	ReasonStatsUnreadable  = "StatsUnreadable"
+)
+
+// Event records an event on the pod.
+func (r *Reconciler) Event(pod *corev1.Pod, eventType, reason, messageFmt string, args ...any) {
+	if r.Recorder == nil || pod == nil {
+		return
+	}
+
+	r.Recorder.Eventf(pod, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/unagex/kondense/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// HealthTimeout is how long a tick can take before kondense is unhealthy.
+	HealthTimeout = 10 * time.Second
+
+	// HealthPort is the default port of the health probes, and MetricsPort the default port of the metrics.
+	// They are uncommon ports, so they don't conflict with the ports of the containers of the pod in sidecar mode.
+	HealthPort  = 9465
+	MetricsPort = 9464
+)
+
+// Healthz succeeds when the last tick of the reconcile loop finished recently.
+func (r *Reconciler) Healthz(w http.ResponseWriter, _ *http.Request) {
+	r.Mu.Lock()
+	lastTick := r.lastTick
+	r.Mu.Unlock()
+
+	if since := time.Since(lastTick); since > HealthTimeout {
+		http.Error(w, fmt.Sprintf("last tick finished %s ago", since.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz succeeds when stats were collected at least once for every managed container
+// and the configuration of every container is valid.
+func (r *Reconciler) Readyz(w http.ResponseWriter, _ *http.Request) {
+	r.Mu.Lock()
+	notReady := r.notReady
+	r.Mu.Unlock()
+
+	if notReady != "" {
+		http.Error(w, notReady, http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// endTick records the end of a tick of the reconcile loop.
+func (r *Reconciler) endTick(pod *corev1.Pod) {
+	notReady := ""
+	exclude := utils.ContainersToExclude()
+	for _, container := range ManagedContainers(pod, r.ResizeSubresource) {
+		if slices.Contains(exclude, container.Name) {
+			continue
+		}
+		if errs := r.configErrors[container.Name]; len(errs) > 0 {
+			notReady = fmt.Sprintf("invalid configuration of container %s: %s", container.Name, errors.Join(errs...))
+			break
+		}
+		if s, ok := r.CStats[container.Name]; !ok || !s.Sampled {
+			notReady = fmt.Sprintf("stats not collected for container %s yet", container.Name)
+		}
+	}
+
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	r.lastTick = time.Now()
+	r.notReady = notReady
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// HistogramFirstBucket is the end of the first bucket of a Histogram, in millicpus.
+	HistogramFirstBucket float64 = 10
+	// HistogramBucketRatio is the ratio between the ends of two consecutive buckets of a Histogram,
+	// so a percentile is known with an error of 5% at most.
+	HistogramBucketRatio float64 = 1.05
+	// HistogramBuckets is the number of buckets of a Histogram. The last bucket starts above 170 cpus.
+	HistogramBuckets = 200
+)
+
+// Histogram is a histogram of the cpu usage of a container, with exponentially growing buckets and exponentially
+// decaying weights, like the histograms of the Vertical Pod Autoscaler. It keeps hours of history in a fixed
+// amount of memory, the most recent samples weighting the most.
+type Histogram struct {
+	// Weights are the decayed weights of the samples of each bucket.
+	Weights []float64
+	// Total is the sum of Weights.
+	Total float64
+	// Last is when the last sample was added.
+	Last time.Time
+}
+
+// Add adds a sample of v millicpus taken at time t. The weights of the previous samples are halved every halfLife.
+func (h *Histogram) Add(v uint64, t time.Time, halfLife time.Duration) {
+	if h.Weights == nil {
+		h.Weights = make([]float64, HistogramBuckets)
+	}
+
+	if !h.Last.IsZero() && t.After(h.Last) && halfLife > 0 {
+		decay := math.Exp2(-float64(t.Sub(h.Last)) / float64(halfLife))
+		for i := range h.Weights {
+			h.Weights[i] *= decay
+		}
+		h.Total *= decay
+	}
+	h.Last = t
+
+	h.Weights[histogramBucket(float64(v))] += 1
+	h.Total += 1
+}
+
+// Percentile returns the end of the bucket of the percentile p of the samples, from 0 to 1, in millicpus.
+// It returns 0 when the histogram is empty.
+func (h *Histogram) Percentile(p float64) uint64 {
+	if h.Total == 0 {
+		return 0
+	}
+
+	threshold := p * h.Total
+	sum := 0.0
+	last := 0
+	for i, w := range h.Weights {
+		if w == 0 {
+			continue
+		}
+		sum += w
+		last = i
+		if sum >= threshold {
+			break
+		}
+	}
+
+	// the sum of the weights can be slightly below Total after rounding.
+	return uint64(math.Ceil(histogramBucketEnd(last)))
+}
+
+// histogramBucket returns the bucket of a value in millicpus.
+func histogramBucket(v float64) int {
+	if v < HistogramFirstBucket {
+		return 0
+	}
+
+	i := int(math.Log(v/HistogramFirstBucket)/math.Log(HistogramBucketRatio)) + 1
+	return min(i, HistogramBuckets-1)
+}
+
+// histogramBucketEnd returns the end of bucket i in millicpus.
+func histogramBucketEnd(i int) float64 {
+	return HistogramFirstBucket * math.Pow(HistogramBucketRatio, float64(i))
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	tests := []struct {
+		v          float64
+		wantBucket int
+	}{
+		{v: 0, wantBucket: 0},
+		{v: 9.9, wantBucket: 0},
+		// the first bucket ends at HistogramFirstBucket.
+		{v: 10, wantBucket: 1},
+		{v: 10.4, wantBucket: 1},
+		{v: 11, wantBucket: 2},
+		// the values above the last bucket are in the last bucket.
+		{v: 1e9, wantBucket: HistogramBuckets - 1},
+	}
+
+	for _, tt := range tests {
+		got := histogramBucket(tt.v)
+		if got != tt.wantBucket {
+			t.Errorf("histogramBucket(%v) = %d, want %d", tt.v, got, tt.wantBucket)
+		}
+		// the value is below the end of its bucket, and above the end of the previous one.
+		if got < HistogramBuckets-1 && tt.v >= histogramBucketEnd(got) {
+			t.Errorf("%v is not below the end of its bucket %v", tt.v, histogramBucketEnd(got))
+		}
+		if got > 0 && tt.v < histogramBucketEnd(got-1) {
+			t.Errorf("%v is below the end of the previous bucket %v", tt.v, histogramBucketEnd(got-1))
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	// repeat returns n samples of v millicpus.
+	repeat := func(n int, v uint64) []uint64 {
+		samples := make([]uint64, n)
+		for i := range samples {
+			samples[i] = v
+		}
+		return samples
+	}
+	uniform := make([]uint64, 100)
+	for i := range uniform {
+		uniform[i] = uint64(i+1) * 10
+	}
+
+	tests := []struct {
+		name    string
+		samples []uint64
+		p       float64
+		want    uint64
+	}{
+		{name: "empty", p: 0.95, want: 0},
+		{name: "constant p50", samples: repeat(10, 300), p: 0.5, want: 300},
+		{name: "constant p95", samples: repeat(10, 300), p: 0.95, want: 300},
+		{name: "uniform p50", samples: uniform, p: 0.5, want: 500},
+		{name: "uniform p95", samples: uniform, p: 0.95, want: 950},
+		{name: "bimodal p50", samples: append(repeat(90, 100), repeat(10, 2_000)...), p: 0.5, want: 100},
+		{name: "bimodal p95", samples: append(repeat(90, 100), repeat(10, 2_000)...), p: 0.95, want: 2_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Histogram{}
+			now := time.Now()
+			for _, v := range tt.samples {
+				h.Add(v, now, time.Hour)
+			}
+
+			// a percentile is the end of its bucket, at most HistogramBucketRatio above the value.
+			got := h.Percentile(tt.p)
+			if float64(got) < float64(tt.want) || float64(got) > math.Ceil(float64(tt.want)*HistogramBucketRatio) {
+				t.Errorf("Percentile(%v) = %d, want between %d and %d", tt.p, got, tt.want, uint64(math.Ceil(float64(tt.want)*HistogramBucketRatio)))
+			}
+		})
+	}
+}
+
+func TestHistogramDecay(t *testing.T) {
+	start := time.Now()
+	halfLife := time.Hour
+
+	h := &Histogram{}
+	h.Add(100, start, halfLife)
+	// the first sample weights half as much after halfLife.
+	h.Add(1_000, start.Add(halfLife), halfLife)
+
+	if math.Abs(h.Total-1.5) > 1e-9 {
+		t.Errorf("total = %v, want %v", h.Total, 1.5)
+	}
+	if w := h.Weights[histogramBucket(100)]; math.Abs(w-0.5) > 1e-9 {
+		t.Errorf("weight of the first sample = %v, want %v", w, 0.5)
+	}
+	// the recent sample weights more than half of the history.
+	if got := h.Percentile(0.5); got < 1_000 {
+		t.Errorf("Percentile(0.5) = %d, want at least %d", got, 1_000)
+	}
+
+	// a sample older than the last one doesn't decay the history.
+	h.Add(1_000, start, halfLife)
+	if math.Abs(h.Total-2.5) > 1e-9 {
+		t.Errorf("total = %v, want %v", h.Total, 2.5)
+	}
+}
+
+func TestCPUPercentilePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples int
+		usage   uint64
+		limit   int64
+		wantMin float64
+		wantMax float64
+	}{
+		// the policy waits for a history of Interval samples.
+		{name: "warm-up", samples: 5, usage: 800, limit: 500, wantMin: 0, wantMax: 0},
+		// the limit is set so the percentile is at TargetAvg of it.
+		{name: "increase", samples: 10, usage: 440, limit: 500, wantMin: 0.1, wantMax: 0.1 + 0.05*1.1},
+		{name: "clamped increase", samples: 10, usage: 800, limit: 500, wantMin: 0.5, wantMax: 0.5},
+		{name: "clamped decrease", samples: 10, usage: 100, limit: 1_000, wantMin: -0.1, wantMax: -0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Stats{Cpu: CPU{
+				CPUConfig: CPUConfig{
+					TargetAvg:  DefaultCPUTargetAvg,
+					MaxInc:     DefaultCPUMaxInc,
+					MaxDec:     DefaultCPUMaxDec,
+					Interval:   DefaultCPUInterval,
+					Percentile: DefaultCPUPercentile,
+				},
+				Limit: tt.limit,
+			}}
+			start := time.Now()
+			for i := 0; i < tt.samples; i++ {
+				s.Cpu.Histogram.Add(tt.usage, start.Add(time.Duration(i)*time.Second), time.Hour)
+			}
+
+			rec := (&CPUPercentilePolicy{}).Recommend(s)
+			if rec.Factor < tt.wantMin-1e-9 || rec.Factor > tt.wantMax+1e-9 {
+				t.Errorf("factor = %v, want between %v and %v", rec.Factor, tt.wantMin, tt.wantMax)
+			}
+			if rec.Signal != SignalCPUPercentile {
+				t.Errorf("signal = %s, want %s", rec.Signal, SignalCPUPercentile)
+			}
+		})
+	}
+}
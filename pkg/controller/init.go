@@ -2,346 +2,651 @@ package controller
 
 import (
 	"fmt"
-	"os"
 	"slices"
 	"strconv"
-	"strings"
 
-	"github.com/rs/zerolog/log"
 	"github.com/unagex/kondense/pkg/utils"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func (r *Reconciler) InitCStats(pod *corev1.Pod) {
-	for _, containerStatus := range pod.Status.ContainerStatuses {
+	for _, container := range ManagedContainers(pod, r.ResizeSubresource) {
 		exclude := utils.ContainersToExclude()
-		if slices.Contains(exclude, containerStatus.Name) {
+		if slices.Contains(exclude, container.Name) {
+			continue
+		}
+		status, ok := containerStatus(pod, container.Name)
+		if !ok {
 			continue
 		}
 
-		if _, ok := r.CStats[containerStatus.Name]; !ok {
-			r.CStats[containerStatus.Name] = &Stats{
-				Mem: Memory{
-					Min:            r.getMemoryMin(containerStatus.Name),
-					Max:            r.getMemoryMax(containerStatus.Name),
-					GraceTicks:     r.getMemoryInterval(containerStatus.Name),
-					Interval:       r.getMemoryInterval(containerStatus.Name),
-					TargetPressure: r.getMemoryTargetPressure(containerStatus.Name),
-					MaxInc:         r.getMemoryMaxInc(containerStatus.Name),
-					MaxDec:         r.getMemoryMaxDec(containerStatus.Name),
-					CoeffInc:       r.getMemoryCoeffInc(containerStatus.Name),
-					CoeffDec:       r.getMemoryCoeffDec(containerStatus.Name),
-				},
-				Cpu: CPU{
-					Min:       r.getCPUMin(containerStatus.Name),
-					Max:       r.getCPUMax(containerStatus.Name),
-					Interval:  r.getCPUInterval(containerStatus.Name),
-					TargetAvg: r.getCPUTargetAvg(containerStatus.Name),
-					MaxInc:    r.getCPUMaxInc(containerStatus.Name),
-					MaxDec:    r.getCPUMaxDec(containerStatus.Name),
-					Coeff:     r.getCPUCoeff(containerStatus.Name),
-				},
+		if _, ok := r.CStats[status.Name]; !ok {
+			config, errs := r.LoadConfig(pod, status.Name)
+			r.setConfigErrors(status.Name, errs)
+			if saved, ok := r.restored[status.Name]; ok {
+				// keep the stats collected before kondense restarted, with the current configuration.
+				delete(r.restored, status.Name)
+				saved.Mem.MemoryConfig = config.Mem
+				saved.Mem.GraceTicks = min(saved.Mem.GraceTicks, config.Mem.Interval)
+				saved.Cpu.CPUConfig = config.Cpu
+				saved.Cpu.GraceTicks = min(saved.Cpu.GraceTicks, config.Cpu.Interval)
+				if len(saved.Cpu.Probes) > int(config.Cpu.Interval) {
+					saved.Cpu.Probes = saved.Cpu.Probes[len(saved.Cpu.Probes)-int(config.Cpu.Interval):]
+				}
+				r.CStats[status.Name] = saved
+			} else {
+				r.CStats[status.Name] = &Stats{
+					Mem: Memory{
+						MemoryConfig: config.Mem,
+						GraceTicks:   config.Mem.Interval,
+					},
+					Cpu: CPU{
+						CPUConfig:  config.Cpu,
+						GraceTicks: config.Cpu.Interval,
+					},
+				}
 			}
 		}
 
-		mem := containerStatus.AllocatedResources.Memory().Value()
-		cpu := containerStatus.AllocatedResources.Cpu().AsApproximateFloat64()
+		mem := status.AllocatedResources.Memory().Value()
+		cpu := status.AllocatedResources.Cpu().MilliValue()
 
-		r.CStats[containerStatus.Name].Mem.Limit = mem
-		r.CStats[containerStatus.Name].Cpu.Limit = int64(cpu * 1000)
+		s := r.CStats[status.Name]
+		s.Mem.Request, s.Mem.Limit = mem, mem
+		s.Cpu.Request, s.Cpu.Limit = cpu, cpu
+		if QOSClass(pod) == corev1.PodQOSBurstable {
+			// the allocated resources are the requests, the limits may be missing.
+			s.Mem.Limit = container.Resources.Limits.Memory().Value()
+			s.Cpu.Limit = container.Resources.Limits.Cpu().MilliValue()
+		}
+
+		if t := status.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+			r.RecordTerminationOOM(status.Name, t.FinishedAt.Time)
+		}
 
-		if r.CStats[containerStatus.Name].Cpu.Probes == nil {
+		if r.CStats[status.Name].Cpu.Probes == nil {
 			// Init queue of capacity Interval
-			r.CStats[containerStatus.Name].Cpu.Probes = make([]Probe, 0, r.CStats[containerStatus.Name].Cpu.Interval)
+			r.CStats[status.Name].Cpu.Probes = make([]Probe, 0, r.CStats[status.Name].Cpu.Interval)
+		}
+	}
+}
+
+// LoadConfig returns the configuration of a container, and every problem found in it.
+// Invalid settings are set to their default value.
+func (r *Reconciler) LoadConfig(pod *corev1.Pod, containerName string) (Config, []error) {
+	var errs []error
+	u := collector[uint64](&errs)
+	f := collector[float64](&errs)
+	str := collector[string](&errs)
+	b := collector[bool](&errs)
+
+	config := Config{
+		Mem: MemoryConfig{
+			Min:                 u(r.getMemoryMin(pod, containerName)),
+			Max:                 u(r.getMemoryMax(pod, containerName)),
+			Interval:            u(r.getMemoryInterval(pod, containerName)),
+			TargetPressure:      u(r.getMemoryTargetPressure(pod, containerName)),
+			MaxInc:              f(r.getMemoryMaxInc(pod, containerName)),
+			MaxDec:              f(r.getMemoryMaxDec(pod, containerName)),
+			CoeffInc:            f(r.getMemoryCoeffInc(pod, containerName)),
+			CoeffDec:            f(r.getMemoryCoeffDec(pod, containerName)),
+			OOMCooldown:         u(r.getMemoryOOMCooldown(pod, containerName)),
+			Policy:              str(r.getMemoryPolicy(pod, containerName)),
+			PIDKp:               f(r.getMemoryPIDGain(pod, containerName, "memory-pid-kp", DefaultMemPIDKp)),
+			PIDKi:               f(r.getMemoryPIDGain(pod, containerName, "memory-pid-ki", DefaultMemPIDKi)),
+			PIDKd:               f(r.getMemoryPIDGain(pod, containerName, "memory-pid-kd", DefaultMemPIDKd)),
+			Predictive:          b(r.getPredictive(pod, containerName, "memory-predictive", DefaultMemPredictive)),
+			PredictiveLookahead: u(r.getPredictiveLookahead(pod, containerName, "memory-predictive-lookahead", DefaultMemPredictiveLookahead)),
+			PredictiveHeadroom:  f(r.getMemoryPredictiveHeadroom(pod, containerName)),
+			LimitPolicy:         str(r.getMemoryLimitPolicy(pod, containerName)),
+			LimitRatio:          f(r.getMemoryLimitRatio(pod, containerName)),
+			LimitBuffer:         u(r.getMemoryLimitBuffer(pod, containerName)),
+		},
+		Cpu: CPUConfig{
+			Min:                 u(r.getCPUMin(pod, containerName)),
+			Max:                 u(r.getCPUMax(pod, containerName)),
+			Interval:            u(r.getCPUInterval(pod, containerName)),
+			TargetAvg:           f(r.getCPUTargetAvg(pod, containerName)),
+			MaxInc:              f(r.getCPUMaxInc(pod, containerName)),
+			MaxDec:              f(r.getCPUMaxDec(pod, containerName)),
+			Coeff:               u(r.getCPUCoeff(pod, containerName)),
+			Policy:              str(r.getCPUPolicy(pod, containerName)),
+			Percentile:          f(r.getCPUPercentile(pod, containerName)),
+			HistoryHalfLife:     u(r.getCPUHistoryHalfLife(pod, containerName)),
+			Predictive:          b(r.getPredictive(pod, containerName, "cpu-predictive", DefaultCPUPredictive)),
+			PredictiveLookahead: u(r.getPredictiveLookahead(pod, containerName, "cpu-predictive-lookahead", DefaultCPUPredictiveLookahead)),
+			TargetPressure:      u(r.getCPUTargetPressure(pod, containerName)),
+			PressureCoeff:       f(r.getCPUPressureCoeff(pod, containerName)),
+			CoeffDec:            f(r.getCPUCoeffDec(pod, containerName)),
+			TargetThrottleRatio: f(r.getCPUTargetThrottleRatio(pod, containerName)),
+			ThrottleCoeff:       f(r.getCPUThrottleCoeff(pod, containerName)),
+			LimitPolicy:         str(r.getCPULimitPolicy(pod, containerName)),
+			LimitRatio:          f(r.getCPULimitRatio(pod, containerName)),
+			LimitBuffer:         u(r.getCPULimitBuffer(pod, containerName)),
+		},
+	}
+
+	errs = append(errs, config.Validate()...)
+	if QOSClass(pod) == corev1.PodQOSBurstable {
+		errs = append(errs, config.ValidateBurstable()...)
+	}
+
+	return config, errs
+}
+
+// collector returns a function returning the value of a getter and collecting its error in errs.
+func collector[T any](errs *[]error) func(T, error) T {
+	return func(v T, err error) T {
+		if err != nil {
+			*errs = append(*errs, err)
 		}
+		return v
 	}
 }
 
-func (r *Reconciler) getMemoryMin(containerName string) uint64 {
-	env := fmt.Sprintf("%s_MEMORY_MIN", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryMin(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-min"); ok {
 		minQ, err := resource.ParseQuantity(v)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %d microseconds.",
-				env, env, DefaultMemMin)
-			return DefaultMemMin
+			return DefaultMemMin, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		min := minQ.Value()
 		if min <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %d microseconds",
-				env, env, DefaultMemMin)
-			return DefaultMemMin
+			return DefaultMemMin, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return uint64(min)
+		return uint64(min), nil
 	}
 
-	return DefaultMemMin
+	return DefaultMemMin, nil
 }
 
-func (r *Reconciler) getMemoryMax(containerName string) uint64 {
-	env := fmt.Sprintf("%s_MEMORY_MAX", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryMax(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-max"); ok {
 		maxQ, err := resource.ParseQuantity(v)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %d microseconds.",
-				env, env, DefaultMemMax)
-			return DefaultMemMax
+			return DefaultMemMax, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		max := maxQ.Value()
 		if max <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %d microseconds",
-				env, env, DefaultMemMax)
-			return DefaultMemMax
+			return DefaultMemMax, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return uint64(max)
+		return uint64(max), nil
 	}
-	return DefaultMemMax
+	return DefaultMemMax, nil
 }
 
-func (r *Reconciler) getMemoryInterval(containerName string) uint64 {
-	env := fmt.Sprintf("%s_MEMORY_INTERVAL", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryInterval(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-interval"); ok {
 		interval, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %ds.",
-				env, env, DefaultMemInterval)
-			return DefaultMemInterval
+			return DefaultMemInterval, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
-		return interval
+		return interval, nil
 	}
 
-	return DefaultMemInterval
+	return DefaultMemInterval, nil
 }
 
-func (r *Reconciler) getMemoryTargetPressure(containerName string) uint64 {
-	env := fmt.Sprintf("%s_MEMORY_TARGET_PRESSURE", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryTargetPressure(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-target-pressure"); ok {
 		targetPressure, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s pressure. Set %s to default value: %d.",
-				env, env, DefaultMemTargetPressure)
-			return DefaultMemTargetPressure
+			return DefaultMemTargetPressure, fmt.Errorf("error cannot parse %s pressure: %w", src, err)
 		}
 		if targetPressure == 0 {
-			log.Error().Msgf("error environment variable: %s should be more than 0. Set %s to default value: %d.",
-				env, env, DefaultMemTargetPressure)
-			return DefaultMemTargetPressure
+			return DefaultMemTargetPressure, fmt.Errorf("error %s should be more than 0", src)
 		}
-		return targetPressure
+		return targetPressure, nil
 	}
 
-	return DefaultMemTargetPressure
+	return DefaultMemTargetPressure, nil
 }
 
-func (r *Reconciler) getMemoryMaxInc(containerName string) float64 {
-	env := fmt.Sprintf("%s_MEMORY_MAX_INC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryMaxInc(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-max-inc"); ok {
 		maxInc, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultMemMaxInc)
-			return DefaultMemMaxInc
+			return DefaultMemMaxInc, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if maxInc <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %.2f.",
-				env, env, DefaultMemMaxInc)
-			return DefaultMemMaxInc
+			return DefaultMemMaxInc, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return maxInc
+		return maxInc, nil
 	}
 
-	return DefaultMemMaxInc
+	return DefaultMemMaxInc, nil
 }
 
-func (r *Reconciler) getMemoryMaxDec(containerName string) float64 {
-	env := fmt.Sprintf("%s_MEMORY_MAX_DEC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryMaxDec(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-max-dec"); ok {
 		maxDec, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultMemMaxDec)
-			return DefaultMemMaxDec
+			return DefaultMemMaxDec, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if maxDec <= 0 || maxDec >= 1 {
-			log.Error().Msgf("error environment variable: %s should be between 0 and 1 exclusive. Set %s to default value: %.2f.",
-				env, env, DefaultMemMaxDec)
-			return DefaultMemMaxDec
+			return DefaultMemMaxDec, fmt.Errorf("error %s should be between 0 and 1 exclusive", src)
 		}
-		return maxDec
+		return maxDec, nil
 	}
 
-	return DefaultMemMaxDec
+	return DefaultMemMaxDec, nil
 }
 
-func (r *Reconciler) getMemoryCoeffInc(containerName string) float64 {
-	env := fmt.Sprintf("%s_MEMORY_MAX_INC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryCoeffInc(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-coeff-inc"); ok {
 		coeffInc, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultMemCoeffInc)
-			return DefaultMemCoeffInc
+			return DefaultMemCoeffInc, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if coeffInc <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %.2f.",
-				env, env, DefaultMemCoeffInc)
-			return DefaultMemCoeffInc
+			return DefaultMemCoeffInc, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return coeffInc
+		return coeffInc, nil
 	}
 
-	return DefaultMemCoeffInc
+	return DefaultMemCoeffInc, nil
 }
 
-func (r *Reconciler) getMemoryCoeffDec(containerName string) float64 {
-	env := fmt.Sprintf("%s_MEMORY_COEFF_DEC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryCoeffDec(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-coeff-dec"); ok {
 		coeffDec, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultMemCoeffDec)
-			return DefaultMemCoeffDec
+			return DefaultMemCoeffDec, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if coeffDec <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %.2f.",
-				env, env, DefaultMemCoeffDec)
-			return DefaultMemCoeffDec
+			return DefaultMemCoeffDec, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return coeffDec, nil
+	}
+
+	return DefaultMemCoeffDec, nil
+}
+
+func (r *Reconciler) getMemoryOOMCooldown(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-oom-cooldown"); ok {
+		cooldown, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return DefaultMemOOMCooldown, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		return cooldown, nil
+	}
+
+	return DefaultMemOOMCooldown, nil
+}
+
+func (r *Reconciler) getMemoryPolicy(pod *corev1.Pod, containerName string) (string, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-policy"); ok {
+		if _, err := newMemoryPolicy(v); err != nil {
+			return DefaultMemPolicy, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		return v, nil
+	}
+
+	return DefaultMemPolicy, nil
+}
+
+// getMemoryPIDGain reads a gain of the pid memory policy, e.g. the setting memory-pid-kp.
+func (r *Reconciler) getMemoryPIDGain(pod *corev1.Pod, containerName, setting string, defaultGain float64) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, setting); ok {
+		gain, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return defaultGain, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if gain < 0 {
+			return defaultGain, fmt.Errorf("error %s should be positive", src)
+		}
+		return gain, nil
+	}
+
+	return defaultGain, nil
+}
+
+func (r *Reconciler) getMemoryLimitPolicy(pod *corev1.Pod, containerName string) (string, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-limit-policy"); ok {
+		if v != LimitPolicyRatio && v != LimitPolicyBuffer {
+			return DefaultMemLimitPolicy, fmt.Errorf("error %s should be %s or %s", src, LimitPolicyRatio, LimitPolicyBuffer)
 		}
-		return coeffDec
+		return v, nil
 	}
 
-	return DefaultMemCoeffDec
+	return DefaultMemLimitPolicy, nil
 }
 
-func (r *Reconciler) getCPUMin(containerName string) uint64 {
-	env := fmt.Sprintf("%s_CPU_MIN", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getMemoryLimitRatio(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-limit-ratio"); ok {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultMemLimitRatio, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if ratio <= 1 {
+			// the limit should stay above the request to keep the QoS class Burstable.
+			return DefaultMemLimitRatio, fmt.Errorf("error %s should be bigger than 1", src)
+		}
+		return ratio, nil
+	}
+
+	return DefaultMemLimitRatio, nil
+}
+
+func (r *Reconciler) getMemoryLimitBuffer(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-limit-buffer"); ok {
+		bufferQ, err := resource.ParseQuantity(v)
+		if err != nil {
+			return DefaultMemLimitBuffer, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		buffer := bufferQ.Value()
+		if buffer <= 0 {
+			return DefaultMemLimitBuffer, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return uint64(buffer), nil
+	}
+
+	return DefaultMemLimitBuffer, nil
+}
+
+func (r *Reconciler) getCPUMin(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-min"); ok {
 		minQ, err := resource.ParseQuantity(v)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %d milliCPU(s).",
-				env, env, DefaultCPUMin)
-			return DefaultCPUMin
+			return DefaultCPUMin, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		min := minQ.MilliValue()
 		if min <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %d milliCPU(s)",
-				env, env, DefaultCPUMin)
-			return DefaultCPUMin
+			return DefaultCPUMin, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return uint64(min)
+		return uint64(min), nil
 	}
 
-	return DefaultCPUMin
+	return DefaultCPUMin, nil
 }
 
-func (r *Reconciler) getCPUMax(containerName string) uint64 {
-	env := fmt.Sprintf("%s_CPU_MAX", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUMax(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-max"); ok {
 		maxQ, err := resource.ParseQuantity(v)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %d milliCPU(s).",
-				env, env, DefaultCPUMax)
-			return DefaultCPUMax
+			return DefaultCPUMax, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		max := maxQ.MilliValue()
 		if max <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %d milliCPU(s)",
-				env, env, DefaultCPUMax)
-			return DefaultCPUMax
+			return DefaultCPUMax, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return uint64(max)
+		return uint64(max), nil
 	}
 
-	return DefaultCPUMax
+	return DefaultCPUMax, nil
 }
 
-func (r *Reconciler) getCPUInterval(containerName string) uint64 {
-	env := fmt.Sprintf("%s_CPU_INTERVAL", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUInterval(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-interval"); ok {
 		interval, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %ds.",
-				env, env, DefaultCPUInterval)
-			return DefaultCPUInterval
+			return DefaultCPUInterval, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
-		return interval
+		return interval, nil
 	}
 
-	return DefaultCPUInterval
+	return DefaultCPUInterval, nil
 }
 
-func (r *Reconciler) getCPUTargetAvg(containerName string) float64 {
-	env := fmt.Sprintf("%s_CPU_TARGET_AVG", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUTargetAvg(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-target-avg"); ok {
 		target, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultCPUTargetAvg)
-			return DefaultCPUTargetAvg
+			return DefaultCPUTargetAvg, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if target <= 0 || target > 1 {
-			log.Error().Msgf("error environment variable :%s should be between 0 and 1. Set %s to default value: %.2f.",
-				env, env, DefaultCPUTargetAvg)
-			return DefaultCPUTargetAvg
+			return DefaultCPUTargetAvg, fmt.Errorf("error %s should be between 0 and 1", src)
 		}
-		return target
+		return target, nil
 	}
 
-	return DefaultCPUTargetAvg
+	return DefaultCPUTargetAvg, nil
 }
 
-func (r *Reconciler) getCPUCoeff(containerName string) uint64 {
-	env := fmt.Sprintf("%s_CPU_COEFF", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUCoeff(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-coeff"); ok {
 		coeff, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %ds.",
-				env, env, DefaultCPUCoeff)
-			return DefaultCPUCoeff
+			return DefaultCPUCoeff, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
-		return coeff
+		return coeff, nil
 	}
 
-	return DefaultCPUCoeff
+	return DefaultCPUCoeff, nil
 }
 
-func (r *Reconciler) getCPUMaxInc(containerName string) float64 {
-	env := fmt.Sprintf("%s_CPU_MAX_INC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUMaxInc(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-max-inc"); ok {
 		maxInc, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultCPUMaxInc)
-			return DefaultCPUMaxInc
+			return DefaultCPUMaxInc, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
 		if maxInc <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %.2f.",
-				env, env, DefaultCPUMaxInc)
-			return DefaultCPUMaxInc
+			return DefaultCPUMaxInc, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		return maxInc
+		return maxInc, nil
 	}
 
-	return DefaultCPUMaxInc
+	return DefaultCPUMaxInc, nil
 }
 
-func (r *Reconciler) getCPUMaxDec(containerName string) float64 {
-	env := fmt.Sprintf("%s_CPU_MAX_DEC", strings.ToUpper(containerName))
-	if v, ok := os.LookupEnv(env); ok {
+func (r *Reconciler) getCPUMaxDec(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-max-dec"); ok {
 		maxDec, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Error().Msgf("error cannot parse environment variable: %s. Set %s to default value: %.2f.",
-				env, env, DefaultCPUMaxDec)
-			return DefaultCPUMaxDec
+			return DefaultCPUMaxDec, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if maxDec <= 0 || maxDec >= 1 {
+			return DefaultCPUMaxDec, fmt.Errorf("error %s should be between 0 and 1 exclusive", src)
+		}
+		return maxDec, nil
+	}
+
+	return DefaultCPUMaxDec, nil
+}
+
+// getCPUPolicy reads the setting cpu-policy, or the setting cpu-mode it replaced.
+func (r *Reconciler) getCPUPolicy(pod *corev1.Pod, containerName string) (string, error) {
+	v, src, ok := r.lookupConfig(pod, containerName, "cpu-policy")
+	if !ok {
+		v, src, ok = r.lookupConfig(pod, containerName, "cpu-mode")
+	}
+	if ok {
+		if _, err := newCPUPolicy(v); err != nil {
+			return DefaultCPUPolicy, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		return v, nil
+	}
+
+	return DefaultCPUPolicy, nil
+}
+
+func (r *Reconciler) getCPUTargetPressure(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-target-pressure"); ok {
+		targetPressure, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return DefaultCPUTargetPressure, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if targetPressure == 0 {
+			return DefaultCPUTargetPressure, fmt.Errorf("error %s should be more than 0", src)
+		}
+		return targetPressure, nil
+	}
+
+	return DefaultCPUTargetPressure, nil
+}
+
+func (r *Reconciler) getCPUPressureCoeff(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-pressure-coeff"); ok {
+		coeff, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPUPressureCoeff, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if coeff <= 0 {
+			return DefaultCPUPressureCoeff, fmt.Errorf("error %s should be bigger than 0", src)
 		}
-		if maxDec <= 0 {
-			log.Error().Msgf("error environment variable: %s should be bigger than 0. Set %s to default value: %.2f.",
-				env, env, DefaultCPUMaxDec)
-			return DefaultCPUMaxDec
+		return coeff, nil
+	}
+
+	return DefaultCPUPressureCoeff, nil
+}
+
+func (r *Reconciler) getCPUCoeffDec(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-coeff-dec"); ok {
+		coeffDec, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPUCoeffDec, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if coeffDec <= 0 {
+			return DefaultCPUCoeffDec, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return coeffDec, nil
+	}
+
+	return DefaultCPUCoeffDec, nil
+}
+
+func (r *Reconciler) getCPUTargetThrottleRatio(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-target-throttle-ratio"); ok {
+		target, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPUTargetThrottleRatio, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if target <= 0 || target > 1 {
+			return DefaultCPUTargetThrottleRatio, fmt.Errorf("error %s should be between 0 and 1", src)
+		}
+		return target, nil
+	}
+
+	return DefaultCPUTargetThrottleRatio, nil
+}
+
+func (r *Reconciler) getCPUThrottleCoeff(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-throttle-coeff"); ok {
+		coeff, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPUThrottleCoeff, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if coeff <= 0 {
+			return DefaultCPUThrottleCoeff, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return coeff, nil
+	}
+
+	return DefaultCPUThrottleCoeff, nil
+}
+
+func (r *Reconciler) getCPULimitPolicy(pod *corev1.Pod, containerName string) (string, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-limit-policy"); ok {
+		if v != LimitPolicyRatio && v != LimitPolicyBuffer {
+			return DefaultCPULimitPolicy, fmt.Errorf("error %s should be %s or %s", src, LimitPolicyRatio, LimitPolicyBuffer)
+		}
+		return v, nil
+	}
+
+	return DefaultCPULimitPolicy, nil
+}
+
+func (r *Reconciler) getCPULimitRatio(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-limit-ratio"); ok {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPULimitRatio, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if ratio <= 1 {
+			// the limit should stay above the request to keep the QoS class Burstable.
+			return DefaultCPULimitRatio, fmt.Errorf("error %s should be bigger than 1", src)
+		}
+		return ratio, nil
+	}
+
+	return DefaultCPULimitRatio, nil
+}
+
+func (r *Reconciler) getCPULimitBuffer(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-limit-buffer"); ok {
+		bufferQ, err := resource.ParseQuantity(v)
+		if err != nil {
+			return DefaultCPULimitBuffer, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		buffer := bufferQ.MilliValue()
+		if buffer <= 0 {
+			return DefaultCPULimitBuffer, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return uint64(buffer), nil
+	}
+
+	return DefaultCPULimitBuffer, nil
+}
+
+func (r *Reconciler) getCPUPercentile(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-percentile"); ok {
+		percentile, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultCPUPercentile, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if percentile <= 0 || percentile > 1 {
+			return DefaultCPUPercentile, fmt.Errorf("error %s should be between 0 and 1", src)
+		}
+		return percentile, nil
+	}
+
+	return DefaultCPUPercentile, nil
+}
+
+func (r *Reconciler) getCPUHistoryHalfLife(pod *corev1.Pod, containerName string) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "cpu-history-half-life"); ok {
+		halfLife, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return DefaultCPUHistoryHalfLife, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if halfLife == 0 {
+			return DefaultCPUHistoryHalfLife, fmt.Errorf("error %s should be bigger than 0", src)
+		}
+		return halfLife, nil
+	}
+
+	return DefaultCPUHistoryHalfLife, nil
+}
+
+// getPredictive reads the setting memory-predictive or cpu-predictive.
+func (r *Reconciler) getPredictive(pod *corev1.Pod, containerName, setting string, defaultPredictive bool) (bool, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, setting); ok {
+		predictive, err := strconv.ParseBool(v)
+		if err != nil {
+			return defaultPredictive, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		return predictive, nil
+	}
+
+	return defaultPredictive, nil
+}
+
+func (r *Reconciler) getMemoryPredictiveHeadroom(pod *corev1.Pod, containerName string) (float64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, "memory-predictive-headroom"); ok {
+		headroom, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return DefaultMemPredictiveHeadroom, fmt.Errorf("error cannot parse %s: %w", src, err)
+		}
+		if headroom < 0 {
+			return DefaultMemPredictiveHeadroom, fmt.Errorf("error %s should be positive", src)
+		}
+		return headroom, nil
+	}
+
+	return DefaultMemPredictiveHeadroom, nil
+}
+
+// getPredictiveLookahead reads the setting memory-predictive-lookahead or cpu-predictive-lookahead.
+func (r *Reconciler) getPredictiveLookahead(pod *corev1.Pod, containerName, setting string, defaultLookahead uint64) (uint64, error) {
+	if v, src, ok := r.lookupConfig(pod, containerName, setting); ok {
+		lookahead, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return defaultLookahead, fmt.Errorf("error cannot parse %s: %w", src, err)
 		}
-		return maxDec
+		return lookahead, nil
 	}
 
-	return DefaultCPUMaxDec
+	return defaultLookahead, nil
 }
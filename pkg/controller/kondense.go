@@ -1,76 +1,157 @@
 package controller
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
-	"net/http"
-	"strconv"
+	"time"
 
-	"github.com/rs/zerolog/log"
-	"github.com/unagex/kondense/pkg/utils"
+	"github.com/unagex/kondense/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
-func (r *Reconciler) KondenseContainer(container corev1.Container) error {
-	memFactor := r.KondenseMemory(container)
-	cpuFactor := r.KondenseCPU(container)
+// pendingState is the state the policies consume when they recommend a resize, e.g. the out-of-memory kill to react
+// to or the grace ticks before a decrease. It is put back when the resize is not patched, so the resize is
+// recommended again on the next tick.
+type pendingState struct {
+	memOOMKilled      bool
+	memGraceTicks     uint64
+	memPeakWorkingSet uint64
+	cpuGraceTicks     uint64
+}
+
+func (s *Stats) pendingState() pendingState {
+	return pendingState{
+		memOOMKilled:      s.Mem.OOMKilled,
+		memGraceTicks:     s.Mem.GraceTicks,
+		memPeakWorkingSet: s.Mem.PeakWorkingSet,
+		cpuGraceTicks:     s.Cpu.GraceTicks,
+	}
+}
+
+func (s *Stats) restorePendingState(p pendingState) {
+	s.Mem.OOMKilled = p.memOOMKilled
+	s.Mem.GraceTicks = p.memGraceTicks
+	s.Mem.PeakWorkingSet = max(s.Mem.PeakWorkingSet, p.memPeakWorkingSet)
+	s.Cpu.GraceTicks = p.cpuGraceTicks
+}
+
+func (r *Reconciler) KondenseContainer(ctx context.Context, pod *corev1.Pod, container corev1.Container) error {
+	// don't patch while a resize is pending or after an infeasible resize.
+	if !r.CanResize() {
+		return nil
+	}
+
+	s := r.CStats[container.Name]
+	pending := s.pendingState()
+
+	var err error
+	if QOSClass(pod) == corev1.PodQOSBurstable {
+		err = r.KondenseBurstable(ctx, pod, container)
+	} else {
+		err = r.KondenseGuaranteed(ctx, pod, container)
+	}
+	if err != nil {
+		// the resize was not patched, e.g. another container of the pod was resized first.
+		s.restorePendingState(pending)
+		if errors.Is(err, errResizeClaimed) {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// KondenseGuaranteed resizes a container of a Guaranteed pod with its memory and cpu policies.
+func (r *Reconciler) KondenseGuaranteed(ctx context.Context, pod *corev1.Pod, container corev1.Container) error {
+	memFactor := r.PredictMemory(container, r.KondenseMemory(container))
+	cpuFactor := r.PredictCPU(container, r.KondenseCPU(container))
+
+	metrics.MemoryFactor.WithLabelValues(r.Namespace, r.Name, container.Name).Set(memFactor)
+	metrics.CPUFactor.WithLabelValues(r.Namespace, r.Name, container.Name).Set(cpuFactor)
 
 	if math.Abs(memFactor) < 0.01 && math.Abs(cpuFactor) < 0.01 {
 		return nil
 	}
 
-	return r.Adjust(container.Name, memFactor, cpuFactor)
+	return r.Adjust(ctx, pod, container.Name, memFactor, cpuFactor)
 }
 
+// KondenseMemory returns the factor to apply to the memory of the container, recommended by its memory policy.
+// The memory is raised right away after an out-of-memory kill and is not decreased during the cool-down that follows.
 func (r *Reconciler) KondenseMemory(container corev1.Container) float64 {
 	s := r.CStats[container.Name]
 
-	if s.Mem.Integral > s.Mem.TargetPressure {
-		// Increase exponentially as we deviate from the target pressure.
-		diff := s.Mem.Integral / max(1, s.Mem.TargetPressure)
-		adj := math.Pow(float64(diff)/DefaultMemCoeffInc, 2)
-		adj = min(adj*s.Mem.MaxInc, s.Mem.MaxInc)
-
+	if s.Mem.OOMKilled {
+		// raise the limit right away after an out-of-memory kill.
+		s.Mem.OOMKilled = false
+		s.Mem.Signal = SignalOOM
 		s.Mem.GraceTicks = s.Mem.Interval - 1
-		return adj
+		return s.Mem.MaxInc
 	}
 
-	// tighten the limit when grace ticks goes to 0.
-	if s.Mem.GraceTicks > 0 {
-		s.Mem.GraceTicks -= 1
+	policy, err := s.memoryPolicy()
+	if err != nil {
+		r.logger().Error().Err(err).Str("container", container.Name).Msg("failed to create memory policy")
 		return 0
 	}
+	rec := policy.Recommend(s)
+	s.Mem.Signal = rec.Signal
 
-	// tighten the limit.
-	diff := s.Mem.TargetPressure / max(s.Mem.Integral, 1)
-	adj := math.Pow(float64(diff)/s.Mem.CoeffDec, 2)
-	adj = min(adj*s.Mem.MaxDec, s.Mem.MaxDec)
+	// don't tighten the limit during the cool-down following an out-of-memory kill.
+	if rec.Factor < 0 && time.Since(s.Mem.LastOOM) < time.Duration(s.Mem.OOMCooldown)*time.Second {
+		return 0
+	}
 
-	s.Mem.GraceTicks = s.Mem.Interval - 1
-	return -adj
+	return rec.Factor
 }
 
+// KondenseCPU returns the factor to apply to the cpu of the container, recommended by its cpu policy.
+// The cpu is raised when the container is throttled, whatever the policy.
 func (r *Reconciler) KondenseCPU(container corev1.Container) float64 {
 	s := r.CStats[container.Name]
 
-	newLimit := float64(s.Cpu.Avg) / max(0.1, s.Cpu.TargetAvg)
-	adj := newLimit/float64(s.Cpu.Limit) - 1
+	policy, err := s.cpuPolicy()
+	if err != nil {
+		r.logger().Error().Err(err).Str("container", container.Name).Msg("failed to create cpu policy")
+		return 0
+	}
+	rec := policy.Recommend(s)
+	adj := rec.Factor
+	s.Cpu.Signal = rec.Signal
+
+	if throttleAdj := r.KondenseCPUThrottle(container); throttleAdj > adj {
+		adj = throttleAdj
+		s.Cpu.Signal = SignalThrottle
+	}
+
+	return adj
+}
 
-	if adj > 0 {
-		adj = adj + math.Pow(float64(s.Cpu.Coeff)*adj, 2)
-		return min(adj, s.Cpu.MaxInc)
+// KondenseCPUThrottle returns the cpu increase needed when the container is throttled more than the target throttle ratio.
+// The container can be throttled in bursts even if the average is low.
+func (r *Reconciler) KondenseCPUThrottle(container corev1.Container) float64 {
+	s := r.CStats[container.Name]
+	if s.Cpu.ThrottleRatio <= s.Cpu.TargetThrottleRatio {
+		return 0
 	}
 
-	return max(adj, -s.Cpu.MaxDec)
+	// Increase exponentially as we deviate from the target throttle ratio.
+	diff := s.Cpu.ThrottleRatio / max(0.01, s.Cpu.TargetThrottleRatio)
+	adj := math.Pow(diff/s.Cpu.ThrottleCoeff, 2)
+	return min(adj*s.Cpu.MaxInc, s.Cpu.MaxInc)
 }
 
-func (r *Reconciler) Adjust(containerName string, memFactor, cpuFactor float64) error {
+func (r *Reconciler) Adjust(ctx context.Context, pod *corev1.Pod, containerName string, memFactor, cpuFactor float64) error {
 	s := r.CStats[containerName]
-	url := fmt.Sprintf("https://kubernetes.default.svc.cluster.local/api/v1/namespaces/%s/pods/%s", r.Namespace, r.Name)
+	// a policy can't decrease or increase more than allowed.
+	memFactor = min(max(memFactor, -s.Mem.MaxDec), s.Mem.MaxInc)
+	cpuFactor = min(max(cpuFactor, -s.Cpu.MaxDec), s.Cpu.MaxInc)
 
 	newMemory := uint64(float64(s.Mem.Limit) * (1 + memFactor))
-	newMemory = min(max(newMemory, s.Mem.Min), s.Mem.Max)
+	newMemory = min(max(newMemory, s.Mem.Min, s.Mem.Floor), s.Mem.Max)
 
 	newCPU := uint64(float64(s.Cpu.Limit) * (1 + cpuFactor))
 	newCPU = min(max(newCPU, s.Cpu.Min), s.Cpu.Max)
@@ -81,57 +162,19 @@ func (r *Reconciler) Adjust(containerName string, memFactor, cpuFactor float64)
 		return nil
 	}
 
-	body := []byte(fmt.Sprintf(
-		`{"spec": {"containers":[{"name":"%s", "resources":{"limits":{"memory": "%d", "cpu": "%dm"},"requests":{"memory": "%d", "cpu": "%dm"}}}]}}`,
-		containerName, newMemory, newCPU, newMemory, newCPU))
-
-	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: *resource.NewQuantity(int64(newMemory), resource.DecimalSI),
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(newCPU), resource.DecimalSI),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceMemory: *resource.NewQuantity(int64(newMemory), resource.DecimalSI),
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(newCPU), resource.DecimalSI),
+		},
 	}
 
-	r.Mu.Lock()
-	bt := r.BearerToken
-	r.Mu.Unlock()
-
-	req.Header.Add("Authorization", bt)
-	req.Header.Add("Content-Type", "application/strategic-merge-patch+json")
-
-	resp, err := r.RawClient.Do(req)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		// renew k8s token
-		bt, err := utils.GetBearerToken()
-		if err != nil {
-			log.Fatal().Msgf("failed to renew k8s bearer token: %s", err)
-		}
-
-		r.Mu.Lock()
-		log.Info().Msg("renewed k8s bearer token.")
-		r.BearerToken = bt
-		r.Mu.Unlock()
-
-		return r.Adjust(containerName, memFactor, cpuFactor)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to patch container, want status code: %d, got %d",
-			http.StatusOK, resp.StatusCode)
-	}
-
-	memFactorLog, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", memFactor), 64)
-	cpuFactorLog, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", cpuFactor), 64)
-	log.Info().
-		Str("container", containerName).
-		Float64("memory_factor", memFactorLog).
-		Uint64("new_memory", newMemory).
-		Float64("cpu_factor", cpuFactorLog).
-		Uint64("new_cpu", newCPU).
-		Msg("patched container")
-
-	s.Mem.Integral = 0
+	message := fmt.Sprintf("memory %d -> %d (%s, factor %.2f), cpu %dm -> %dm (%s, factor %.2f)",
+		s.Mem.Limit, newMemory, s.Mem.Signal, memFactor, s.Cpu.Limit, newCPU, s.Cpu.Signal, cpuFactor)
 
-	return nil
+	return r.applyResize(ctx, pod, containerName, resources, MemUpdate, CPUUpdate, memFactor, cpuFactor, message)
 }
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKondenseCPUThrottle(t *testing.T) {
+	tests := []struct {
+		name          string
+		throttleRatio float64
+		throttleCoeff float64
+		want          float64
+	}{
+		{name: "below target", throttleRatio: 0.05, throttleCoeff: 6, want: 0},
+		// the increase reaches MaxInc when the throttle ratio is ThrottleCoeff times the target.
+		{name: "at coeff times target", throttleRatio: 0.6, throttleCoeff: 6, want: 0.5},
+		{name: "half of coeff times target", throttleRatio: 0.3, throttleCoeff: 6, want: 0.125},
+		// the higher the coeff, the smaller the increase.
+		{name: "higher coeff", throttleRatio: 0.3, throttleCoeff: 12, want: 0.03125},
+		{name: "clamped", throttleRatio: 1, throttleCoeff: 2, want: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+			r, _ := newTestReconciler(t, pod)
+			s := r.CStats["app"]
+			s.Cpu.ThrottleRatio = tt.throttleRatio
+			s.Cpu.ThrottleCoeff = tt.throttleCoeff
+
+			if got := r.KondenseCPUThrottle(pod.Spec.Containers[0]); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("KondenseCPUThrottle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
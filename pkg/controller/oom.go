@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"time"
+)
+
+// RecordOOM records an out-of-memory kill of the container at time t.
+// The memory limit is raised on the next tick, a floor is set above the
+// limit the container was killed at and decreases are paused for OOMCooldown.
+func (r *Reconciler) RecordOOM(containerName string, t time.Time) {
+	s := r.CStats[containerName]
+
+	s.Mem.OOMKilled = true
+	s.Mem.LastOOM = t
+	s.Mem.Floor = max(s.Mem.Floor, uint64(float64(s.Mem.Limit)*(1+MemOOMFloorMargin)))
+
+	r.logger().Warn().
+		Str("container", containerName).
+		Int64("memory_limit", s.Mem.Limit).
+		Uint64("memory_floor", s.Mem.Floor).
+		Msg("container was out-of-memory killed")
+}
+
+// RecordTerminationOOM records an out-of-memory kill found in the last termination state of the container.
+// Terminations older than the cool-down, or already recorded from the memory events, are ignored.
+func (r *Reconciler) RecordTerminationOOM(containerName string, finishedAt time.Time) {
+	s := r.CStats[containerName]
+
+	if time.Since(finishedAt) > time.Duration(s.Mem.OOMCooldown)*time.Second {
+		return
+	}
+	// the same kill is usually seen in memory.events before the container restarts.
+	if !finishedAt.After(s.Mem.LastOOM.Add(10 * time.Second)) {
+		return
+	}
+
+	r.RecordOOM(containerName, finishedAt)
+}
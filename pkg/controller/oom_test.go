@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+)
+
+func TestUpdateStatsOOMKill(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, source := newTestReconciler(t, pod)
+	container := pod.Spec.Containers[0]
+
+	// the kills before the first sample are not recorded again.
+	source.Set("app", Sample{MemEvents: cgroup.MemoryEvents{OOMKill: 3}})
+	if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+		t.Fatalf("UpdateStats() error = %s", err)
+	}
+	if r.CStats["app"].Mem.OOMKilled {
+		t.Fatalf("baseline sample recorded an out-of-memory kill")
+	}
+
+	source.Set("app", Sample{MemEvents: cgroup.MemoryEvents{OOMKill: 4}})
+	if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+		t.Fatalf("UpdateStats() error = %s", err)
+	}
+
+	s := r.CStats["app"]
+	if !s.Mem.OOMKilled {
+		t.Fatalf("out-of-memory kill not recorded")
+	}
+	if want := uint64(float64(s.Mem.Limit) * (1 + MemOOMFloorMargin)); s.Mem.Floor != want {
+		t.Errorf("floor = %d, want %d", s.Mem.Floor, want)
+	}
+}
+
+func TestKondenseContainerOOMKill(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, source := newTestReconciler(t, pod)
+	container := pod.Spec.Containers[0]
+
+	for _, kills := range []uint64{0, 1} {
+		source.Set("app", Sample{MemEvents: cgroup.MemoryEvents{OOMKill: kills}})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("UpdateStats() error = %s", err)
+		}
+	}
+
+	err := r.KondenseContainer(context.Background(), pod, container)
+	if err != nil {
+		t.Fatalf("KondenseContainer() error = %s", err)
+	}
+
+	// the memory is raised by MaxInc right away.
+	if got := patchedLimit(t, r); got != 150_000_000 {
+		t.Errorf("memory limit = %d, want %d", got, 150_000_000)
+	}
+	if s := r.CStats["app"]; s.Mem.Signal != SignalOOM {
+		t.Errorf("signal = %s, want %s", s.Mem.Signal, SignalOOM)
+	}
+}
+
+func TestRecordTerminationOOM(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		lastOOM    time.Time
+		finishedAt time.Time
+		want       bool
+	}{
+		{name: "recent termination", finishedAt: now.Add(-time.Minute), want: true},
+		{name: "termination before the cool-down", finishedAt: now.Add(-time.Duration(DefaultMemOOMCooldown+60) * time.Second)},
+		// the kill was already recorded from the memory events before the container restarted.
+		{name: "already recorded", lastOOM: now.Add(-time.Minute), finishedAt: now.Add(-time.Minute + 5*time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+			r, _ := newTestReconciler(t, pod)
+			r.CStats["app"].Mem.LastOOM = tt.lastOOM
+
+			r.RecordTerminationOOM("app", tt.finishedAt)
+			if got := r.CStats["app"].Mem.OOMKilled; got != tt.want {
+				t.Errorf("out-of-memory kill = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/unagex/kondense/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// EnabledKey is the label or annotation opting a pod in kondense when kondense runs as an operator or a node agent,
+// e.g. kondense.unagex.com/enabled: "true".
+const EnabledKey = AnnotationPrefix + "enabled"
+
+// Operator resizes the containers of every selected pod of the cluster, from a single deployment,
+// or of every selected pod of a node, from a daemonset. Each pod has its own Reconciler, so its state
+// is kept separately.
+type Operator struct {
+	Client kubernetes.Interface
+	// Recorder records the resize decisions as events on the pods. Events are not recorded when it is nil.
+	Recorder record.EventRecorder
+
+	Source StatsSource
+	// ConfigDir is where a ConfigMap configuring the containers is mounted. It is optional.
+	ConfigDir string
+	// StateDir is where the state of each pod is saved, in a file named after the pod uid. It is optional.
+	StateDir string
+
+	// Namespace restricts the pods to a namespace. The pods of every namespace are watched when empty.
+	Namespace string
+	// Selector is a label selector restricting the watched pods, e.g. app=nginx. It is optional.
+	Selector string
+	// NodeName restricts the pods to a node, when kondense runs as a node agent. It is optional.
+	NodeName string
+	// Selected returns true when a pod is kondensed. It defaults to Enabled.
+	Selected func(pod *corev1.Pod) bool
+
+	Mu sync.Mutex
+	// reconcilers are the reconcilers of the selected pods, keyed by pod uid.
+	reconcilers map[types.UID]*Reconciler
+	// stopped are the pods that can't be kondensed, e.g. BestEffort pods or completed Jobs.
+	stopped map[types.UID]bool
+
+	resizeSubresource bool
+	// lastTick is when the last tick of the reconcile loop finished.
+	lastTick time.Time
+	// synced is true once the informer synced.
+	synced bool
+}
+
+// Enabled returns true when the pod has the label or the annotation EnabledKey set to true.
+func Enabled(pod *corev1.Pod) bool {
+	return pod.Labels[EnabledKey] == "true" || pod.Annotations[EnabledKey] == "true"
+}
+
+// Reconcile resizes the containers of the selected pods every second, until ctx is done.
+// It returns an error when it stopped for another reason.
+func (o *Operator) Reconcile(ctx context.Context) error {
+	o.Mu.Lock()
+	o.reconcilers = map[types.UID]*Reconciler{}
+	o.stopped = map[types.UID]bool{}
+	// don't report kondense unhealthy while the informer syncs.
+	o.lastTick = time.Now()
+	o.Mu.Unlock()
+
+	o.resizeSubresource = (&Reconciler{Client: o.Client}).SupportsResizeSubresource()
+
+	err := o.WatchPods(ctx)
+	if err != nil {
+		return fmt.Errorf("error failed to watch pods: %w", err)
+	}
+
+	var start time.Time
+	var loopTime time.Duration
+	for {
+		// one iteration should take 1 second.
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second - loopTime):
+		}
+		start = time.Now()
+
+		o.Tick(ctx)
+
+		loopTime = time.Since(start)
+	}
+}
+
+// Tick runs one iteration of the reconcile loop of every selected pod, concurrently.
+func (o *Operator) Tick(ctx context.Context) {
+	o.Mu.Lock()
+	reconcilers := make(map[types.UID]*Reconciler, len(o.reconcilers))
+	for uid, r := range o.reconcilers {
+		if !o.stopped[uid] {
+			reconcilers[uid] = r
+		}
+	}
+	o.Mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(reconcilers))
+
+	for uid, r := range reconcilers {
+		go func(uid types.UID, r *Reconciler) {
+			defer wg.Done()
+
+			err := r.Tick(ctx)
+			if errors.Is(err, ErrBestEffort) || errors.Is(err, ErrPodCompleted) {
+				r.logger().Info().Err(err).Msg("not kondensing pod anymore")
+				o.Mu.Lock()
+				o.stopped[uid] = true
+				o.Mu.Unlock()
+				return
+			}
+			if err != nil {
+				r.logger().Error().Err(err).Msg("failed to reconcile pod")
+			}
+		}(uid, r)
+	}
+
+	wg.Wait()
+
+	o.Mu.Lock()
+	o.lastTick = time.Now()
+	o.Mu.Unlock()
+}
+
+// WatchPods starts an informer on the pods matching Namespace, Selector and NodeName and waits for its cache to sync.
+func (o *Operator) WatchPods(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(o.Client, 0,
+		informers.WithNamespace(o.Namespace),
+		informers.WithTweakListOptions(func(opts *v1.ListOptions) {
+			opts.LabelSelector = o.Selector
+			if o.NodeName != "" {
+				opts.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", o.NodeName).String()
+			}
+		}),
+	)
+
+	informer := factory.Core().V1().Pods().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			o.SetPod(obj.(*corev1.Pod))
+		},
+		UpdateFunc: func(_, obj any) {
+			o.SetPod(obj.(*corev1.Pod))
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				o.DeletePod(pod)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("error failed to sync informer for %v", typ)
+		}
+	}
+
+	o.Mu.Lock()
+	o.synced = true
+	o.Mu.Unlock()
+
+	log.Info().Str("namespace", o.Namespace).Str("selector", o.Selector).Str("node", o.NodeName).Msg("watching pods")
+
+	return nil
+}
+
+// SetPod sets the latest version of a pod, creating its reconciler when the pod is selected
+// and deleting it when the pod is not selected anymore.
+func (o *Operator) SetPod(pod *corev1.Pod) {
+	selected := o.Selected
+	if selected == nil {
+		selected = Enabled
+	}
+	if !selected(pod) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		o.DeletePod(pod)
+		return
+	}
+
+	o.Mu.Lock()
+	r, ok := o.reconcilers[pod.UID]
+	if !ok {
+		stateFile := ""
+		if o.StateDir != "" {
+			stateFile = filepath.Join(o.StateDir, string(pod.UID)+".json")
+		}
+		r = &Reconciler{
+			Client:            o.Client,
+			Recorder:          o.Recorder,
+			Source:            o.Source,
+			ConfigDir:         o.ConfigDir,
+			StateFile:         stateFile,
+			Namespace:         pod.Namespace,
+			Name:              pod.Name,
+			CStats:            ContainerStats{},
+			ResizeSubresource: o.resizeSubresource,
+		}
+		o.reconcilers[pod.UID] = r
+	}
+	o.Mu.Unlock()
+
+	if !ok {
+		r.logger().Info().Msg("kondensing pod")
+	}
+	r.SetPod(pod)
+}
+
+// DeletePod forgets a pod and its state.
+func (o *Operator) DeletePod(pod *corev1.Pod) {
+	o.Mu.Lock()
+	r, ok := o.reconcilers[pod.UID]
+	delete(o.reconcilers, pod.UID)
+	delete(o.stopped, pod.UID)
+	o.Mu.Unlock()
+
+	if ok {
+		r.logger().Info().Msg("stopped kondensing pod")
+		metrics.DeletePod(pod.Namespace, pod.Name)
+		r.DeleteState()
+	}
+}
+
+// Healthz succeeds when the last tick of the reconcile loop finished recently.
+func (o *Operator) Healthz(w http.ResponseWriter, _ *http.Request) {
+	o.Mu.Lock()
+	lastTick := o.lastTick
+	o.Mu.Unlock()
+
+	if since := time.Since(lastTick); since > HealthTimeout {
+		http.Error(w, fmt.Sprintf("last tick finished %s ago", since.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz succeeds once the pods are watched.
+func (o *Operator) Readyz(w http.ResponseWriter, _ *http.Request) {
+	o.Mu.Lock()
+	synced := o.synced
+	o.Mu.Unlock()
+
+	if !synced {
+		http.Error(w, "pods not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/unagex/kondense/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// errResizeClaimed is returned when the resize of another container of the pod is pending.
+var errResizeClaimed = errors.New("error another container of the pod is being resized")
+
+// PatchBackoff is the backoff between patch retries.
+var PatchBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+type podPatch struct {
+	Spec podSpecPatch `json:"spec"`
+}
+
+type podSpecPatch struct {
+	Containers     []containerPatch `json:"containers,omitempty"`
+	InitContainers []containerPatch `json:"initContainers,omitempty"`
+}
+
+type containerPatch struct {
+	Name      string                      `json:"name"`
+	Resources corev1.ResourceRequirements `json:"resources"`
+}
+
+// Patch sets the resources of a container or of a native sidecar with a strategic merge patch, through the
+// resize subresource when the API server has it. Conflicts, throttling and server errors are retried with PatchBackoff.
+// It returns the patched pod.
+func (r *Reconciler) Patch(ctx context.Context, pod *corev1.Pod, containerName string, resources corev1.ResourceRequirements) (*corev1.Pod, error) {
+	containers := []containerPatch{{
+		Name:      containerName,
+		Resources: resources,
+	}}
+	spec := podSpecPatch{Containers: containers}
+	if isInitContainer(pod, containerName) {
+		spec = podSpecPatch{InitContainers: containers}
+	}
+
+	body, err := json.Marshal(podPatch{Spec: spec})
+	if err != nil {
+		return nil, err
+	}
+
+	var subresources []string
+	if r.ResizeSubresource {
+		subresources = append(subresources, "resize")
+	}
+
+	var patched *corev1.Pod
+	err = retry.OnError(PatchBackoff, isRetriable, func() error {
+		patched, err = r.Client.CoreV1().Pods(r.Namespace).Patch(ctx, r.Name, types.StrategicMergePatchType, body, v1.PatchOptions{}, subresources...)
+		return err
+	})
+
+	return patched, err
+}
+
+// applyResize patches the resources of the container computed from the memory and cpu factors, and records the resize.
+// memUpdate and cpuUpdate are true when the memory or the cpu changed, so the pressure integral of the resource
+// starts again. message describes the resize in the event.
+func (r *Reconciler) applyResize(ctx context.Context, pod *corev1.Pod, containerName string, resources corev1.ResourceRequirements,
+	memUpdate, cpuUpdate bool, memFactor, cpuFactor float64, message string) error {
+	s := r.CStats[containerName]
+
+	// the containers are kondensed concurrently, only one of them is resized at a time.
+	if !r.ClaimResize(containerName) {
+		return errResizeClaimed
+	}
+
+	patched, err := r.Patch(ctx, pod, containerName, resources)
+	if err != nil {
+		r.ReleaseResize()
+		metrics.PatchFailures.WithLabelValues(r.Namespace, r.Name, containerName).Inc()
+		r.Event(pod, corev1.EventTypeWarning, ReasonResizeFailed, "Failed to resize container %s: %s", containerName, err)
+		return err
+	}
+	metrics.Patches.WithLabelValues(r.Namespace, r.Name, containerName).Inc()
+
+	memFactorLog, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", memFactor), 64)
+	cpuFactorLog, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", cpuFactor), 64)
+	l := r.logger().Info().
+		Str("container", containerName).
+		Float64("memory_factor", memFactorLog).
+		Float64("cpu_factor", cpuFactorLog)
+	if q, ok := resources.Requests[corev1.ResourceMemory]; ok {
+		l = l.Int64("new_memory_request", q.Value())
+	}
+	if q, ok := resources.Limits[corev1.ResourceMemory]; ok {
+		l = l.Int64("new_memory_limit", q.Value())
+	}
+	if q, ok := resources.Requests[corev1.ResourceCPU]; ok {
+		l = l.Int64("new_cpu_request", q.MilliValue())
+	}
+	if q, ok := resources.Limits[corev1.ResourceCPU]; ok {
+		l = l.Int64("new_cpu_limit", q.MilliValue())
+	}
+	l.Msg("patched container")
+
+	r.Event(pod, corev1.EventTypeNormal, ReasonResized, "Resized container %s: %s", containerName, message)
+
+	// the integral of a resource that was not patched keeps accumulating.
+	if memUpdate {
+		s.Mem.Integral = 0
+	}
+	if cpuUpdate {
+		s.Cpu.Integral = 0
+	}
+
+	r.StartResize(patched)
+
+	return nil
+}
+
+func isRetriable(err error) bool {
+	if apierrors.IsConflict(err) || apierrors.IsTooManyRequests(err) {
+		return true
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Code >= 500
+	}
+
+	return false
+}
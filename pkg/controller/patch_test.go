@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAdjust(t *testing.T) {
+	tests := []struct {
+		name       string
+		memFactor  float64
+		cpuFactor  float64
+		wantMemory int64
+		wantCPU    int64
+		wantPatch  bool
+	}{
+		{name: "increase", memFactor: 0.2, cpuFactor: 0.1, wantMemory: 120_000_000, wantCPU: 550, wantPatch: true},
+		// the factors are clamped to MaxInc and MaxDec.
+		{name: "clamped increase", memFactor: 3, cpuFactor: 0, wantMemory: 150_000_000, wantCPU: 500, wantPatch: true},
+		{name: "clamped decrease", memFactor: -0.5, cpuFactor: -0.5, wantMemory: 98_000_000, wantCPU: 450, wantPatch: true},
+		{name: "no change", memFactor: 0, cpuFactor: 0, wantMemory: 100_000_000, wantCPU: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+			r, _ := newTestReconciler(t, pod)
+
+			err := r.Adjust(context.Background(), pod, "app", tt.memFactor, tt.cpuFactor)
+			if err != nil {
+				t.Fatalf("Adjust() error = %s", err)
+			}
+
+			c := patchedContainer(t, r)
+			want := resources(tt.wantMemory, tt.wantCPU)
+			for _, list := range []corev1.ResourceList{c.Resources.Requests, c.Resources.Limits} {
+				if list.Memory().Value() != tt.wantMemory || list.Cpu().MilliValue() != tt.wantCPU {
+					t.Errorf("resources = %v, want %v", list, want)
+				}
+			}
+			if r.Resize.Pending != tt.wantPatch {
+				t.Errorf("resize pending = %t, want %t", r.Resize.Pending, tt.wantPatch)
+			}
+		})
+	}
+}
+
+func TestPatchRetries(t *testing.T) {
+	backoff := PatchBackoff
+	PatchBackoff = wait.Backoff{Steps: 3, Duration: time.Millisecond}
+	t.Cleanup(func() { PatchBackoff = backoff })
+
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	gr := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "no error", wantCalls: 1},
+		// conflicts and server errors are retried.
+		{name: "conflicts", errs: []error{apierrors.NewConflict(gr, pod.Name, nil), apierrors.NewConflict(gr, pod.Name, nil)}, wantCalls: 3},
+		{name: "server error", errs: []error{apierrors.NewInternalError(errors.New("error etcd"))}, wantCalls: 2},
+		{name: "too many requests", errs: []error{apierrors.NewTooManyRequests("throttled", 1)}, wantCalls: 2},
+		{name: "retries exhausted", errs: []error{
+			apierrors.NewServerTimeout(gr, "patch", 1), apierrors.NewServerTimeout(gr, "patch", 1), apierrors.NewServerTimeout(gr, "patch", 1),
+		}, wantCalls: 3, wantErr: true},
+		// the other errors are not retried.
+		{name: "forbidden", errs: []error{apierrors.NewForbidden(gr, pod.Name, errors.New("error no resize permission"))}, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, pod)
+			calls := 0
+			r.Client.(*fake.Clientset).PrependReactor("patch", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return true, nil, tt.errs[calls-1]
+				}
+				return false, nil, nil
+			})
+
+			err := r.Adjust(context.Background(), pod, "app", 0.2, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Adjust() error = %v, want error %t", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("patch calls = %d, want %d", calls, tt.wantCalls)
+			}
+
+			// a failed patch releases the resize, the next tick can patch again.
+			if r.Resize.Pending == tt.wantErr {
+				t.Errorf("resize pending = %t, want %t", r.Resize.Pending, !tt.wantErr)
+			}
+			want := int64(120_000_000)
+			if tt.wantErr {
+				want = 100_000_000
+			}
+			if got := patchedLimit(t, r); got != want {
+				t.Errorf("memory limit = %d, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// MemoryPolicyTMO sizes memory to keep the memory pressure near TargetPressure.
+	MemoryPolicyTMO = "tmo"
+	// MemoryPolicyPID sizes memory with a pid controller keeping the memory pressure near TargetPressure.
+	MemoryPolicyPID = "pid"
+	// CPUPolicyAvg sizes cpu to keep the average cpu usage near TargetAvg.
+	CPUPolicyAvg = "avg"
+	// CPUPolicyPressure sizes cpu to keep the cpu pressure near TargetPressure.
+	CPUPolicyPressure = "pressure"
+	// CPUPolicyPercentile sizes cpu on the Percentile of the cpu usage over a long history.
+	CPUPolicyPercentile = "percentile"
+)
+
+// Policy recommends how to resize a resource of a container from its stats. The stats hold the current limits,
+// the history of the container, e.g. the cpu probes and the pressure integrals, and the configuration of the container.
+//
+// A Policy is created for each container and resource, so it can keep state between ticks. The state kept in the
+// stats, e.g. the grace ticks, is also saved in the state file and survives a restart of kondense.
+type Policy interface {
+	Recommend(s *Stats) Recommendation
+}
+
+// Recommendation is a resize recommended by a Policy.
+type Recommendation struct {
+	// Factor is the factor to apply to the limit. e.g. 0.5 is a 50% increase, -0.1 is a 10% decrease.
+	Factor float64
+	// Signal is what triggered the recommendation.
+	Signal Signal
+}
+
+// NewPolicy creates the Policy of a container.
+type NewPolicy func() Policy
+
+var (
+	policiesMu     sync.RWMutex
+	memoryPolicies = map[string]NewPolicy{
+		MemoryPolicyTMO: func() Policy { return &TMOPolicy{} },
+		MemoryPolicyPID: func() Policy { return &PIDPolicy{} },
+	}
+	cpuPolicies = map[string]NewPolicy{
+		CPUPolicyAvg:        func() Policy { return &CPUAvgPolicy{} },
+		CPUPolicyPressure:   func() Policy { return &CPUPressurePolicy{} },
+		CPUPolicyPercentile: func() Policy { return &CPUPercentilePolicy{} },
+	}
+)
+
+// RegisterMemoryPolicy registers a memory policy. Containers use it with the setting memory-policy set to name.
+// It replaces the policy registered with the same name.
+func RegisterMemoryPolicy(name string, newPolicy NewPolicy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+
+	memoryPolicies[name] = newPolicy
+}
+
+// RegisterCPUPolicy registers a cpu policy. Containers use it with the setting cpu-policy set to name.
+// It replaces the policy registered with the same name.
+func RegisterCPUPolicy(name string, newPolicy NewPolicy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+
+	cpuPolicies[name] = newPolicy
+}
+
+// newMemoryPolicy creates the memory policy named name.
+func newMemoryPolicy(name string) (Policy, error) {
+	return newPolicy(memoryPolicies, "memory", name)
+}
+
+// newCPUPolicy creates the cpu policy named name.
+func newCPUPolicy(name string) (Policy, error) {
+	return newPolicy(cpuPolicies, "cpu", name)
+}
+
+func newPolicy(policies map[string]NewPolicy, resource, name string) (Policy, error) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	if newPolicy, ok := policies[name]; ok {
+		return newPolicy(), nil
+	}
+
+	names := []string{}
+	for n := range policies {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+
+	return nil, fmt.Errorf("error unknown %s policy: %s, want one of: %s", resource, name, strings.Join(names, ", "))
+}
+
+// memoryPolicy returns the memory policy of the container, created again when the configured policy changed.
+func (s *Stats) memoryPolicy() (Policy, error) {
+	if s.Mem.policy == nil || s.Mem.policyName != s.Mem.Policy {
+		policy, err := newMemoryPolicy(s.Mem.Policy)
+		if err != nil {
+			return nil, err
+		}
+		s.Mem.policy, s.Mem.policyName = policy, s.Mem.Policy
+	}
+
+	return s.Mem.policy, nil
+}
+
+// cpuPolicy returns the cpu policy of the container, created again when the configured policy changed.
+func (s *Stats) cpuPolicy() (Policy, error) {
+	if s.Cpu.policy == nil || s.Cpu.policyName != s.Cpu.Policy {
+		policy, err := newCPUPolicy(s.Cpu.Policy)
+		if err != nil {
+			return nil, err
+		}
+		s.Cpu.policy, s.Cpu.policyName = policy, s.Cpu.Policy
+	}
+
+	return s.Cpu.policy, nil
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"math"
+)
+
+// CPUAvgPolicy sizes cpu to keep the average cpu usage of the container near its target average.
+type CPUAvgPolicy struct{}
+
+func (p *CPUAvgPolicy) Recommend(s *Stats) Recommendation {
+	newLimit := float64(s.Cpu.Avg) / max(0.1, s.Cpu.TargetAvg)
+	adj := newLimit/float64(max(1, s.Cpu.Limit)) - 1
+
+	if adj > 0 {
+		adj = adj + math.Pow(float64(s.Cpu.Coeff)*adj, 2)
+		return Recommendation{Factor: min(adj, s.Cpu.MaxInc), Signal: SignalCPUAvg}
+	}
+
+	return Recommendation{Factor: max(adj, -s.Cpu.MaxDec), Signal: SignalCPUAvg}
+}
+
+// CPUPressurePolicy sizes cpu to keep the cpu stall time of the container near its target pressure,
+// the same way TMOPolicy does for memory. It suits latency sensitive containers.
+type CPUPressurePolicy struct{}
+
+func (p *CPUPressurePolicy) Recommend(s *Stats) Recommendation {
+	if s.Cpu.Integral > s.Cpu.TargetPressure {
+		// Increase exponentially as we deviate from the target pressure.
+		diff := s.Cpu.Integral / max(1, s.Cpu.TargetPressure)
+		adj := math.Pow(float64(diff)/s.Cpu.PressureCoeff, 2)
+		adj = min(adj*s.Cpu.MaxInc, s.Cpu.MaxInc)
+
+		s.Cpu.GraceTicks = s.Cpu.Interval - 1
+		return Recommendation{Factor: adj, Signal: SignalCPUPressure}
+	}
+
+	// tighten the limit when grace ticks goes to 0.
+	if s.Cpu.GraceTicks > 0 {
+		s.Cpu.GraceTicks -= 1
+		return Recommendation{Signal: SignalCPUPressure}
+	}
+
+	// tighten the limit.
+	diff := s.Cpu.TargetPressure / max(s.Cpu.Integral, 1)
+	adj := math.Pow(float64(diff)/s.Cpu.CoeffDec, 2)
+	adj = min(adj*s.Cpu.MaxDec, s.Cpu.MaxDec)
+
+	s.Cpu.GraceTicks = s.Cpu.Interval - 1
+	return Recommendation{Factor: -adj, Signal: SignalCPUPressure}
+}
+
+// CPUPercentilePolicy sizes cpu on a percentile of the cpu usage of the container over a long history, e.g. its P95
+// over the last hours, so bursty containers are not sized on their mean. The limit is set so the percentile is at
+// TargetAvg of it. The history is a Histogram of the usage of every second, whose weights decay with HistoryHalfLife.
+type CPUPercentilePolicy struct{}
+
+func (p *CPUPercentilePolicy) Recommend(s *Stats) Recommendation {
+	// wait for enough samples.
+	if s.Cpu.Histogram.Total < float64(s.Cpu.Interval) {
+		return Recommendation{Signal: SignalCPUPercentile}
+	}
+
+	newLimit := float64(s.Cpu.Histogram.Percentile(s.Cpu.Percentile)) / max(0.1, s.Cpu.TargetAvg)
+	adj := newLimit/float64(max(1, s.Cpu.Limit)) - 1
+
+	return Recommendation{Factor: min(max(adj, -s.Cpu.MaxDec), s.Cpu.MaxInc), Signal: SignalCPUPercentile}
+}
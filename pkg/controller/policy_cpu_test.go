@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCPUPressurePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		integral      uint64
+		pressureCoeff float64
+		graceTicks    uint64
+		want          float64
+	}{
+		// the increase reaches MaxInc when the pressure is PressureCoeff times the target.
+		{name: "at coeff times target", integral: 600_000, pressureCoeff: 6, want: 0.5},
+		{name: "half of coeff times target", integral: 300_000, pressureCoeff: 6, want: 0.125},
+		// the higher the coeff, the smaller the increase.
+		{name: "higher coeff", integral: 300_000, pressureCoeff: 12, want: 0.03125},
+		{name: "clamped", integral: 1_000_000, pressureCoeff: 2, want: 0.5},
+		{name: "grace ticks", integral: 50_000, pressureCoeff: 6, graceTicks: 2, want: 0},
+		// the decrease reaches MaxDec when the pressure is 1/CoeffDec times the target.
+		{name: "decrease", integral: 10_000, pressureCoeff: 6, want: -0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Stats{Cpu: CPU{
+				CPUConfig: CPUConfig{
+					TargetPressure: DefaultCPUTargetPressure,
+					PressureCoeff:  tt.pressureCoeff,
+					CoeffDec:       DefaultCPUCoeffDec,
+					MaxInc:         DefaultCPUMaxInc,
+					MaxDec:         DefaultCPUMaxDec,
+					Interval:       DefaultCPUInterval,
+				},
+				Integral:   tt.integral,
+				GraceTicks: tt.graceTicks,
+			}}
+
+			rec := (&CPUPressurePolicy{}).Recommend(s)
+			if math.Abs(rec.Factor-tt.want) > 1e-9 {
+				t.Errorf("factor = %v, want %v", rec.Factor, tt.want)
+			}
+			if rec.Signal != SignalCPUPressure {
+				t.Errorf("signal = %s, want %s", rec.Signal, SignalCPUPressure)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+// PIDPolicy sizes memory with a PID controller keeping the memory pressure of the container near its target pressure.
+// It reacts proportionally to the error instead of the squared ratio of TMOPolicy, so it oscillates less on workloads
+// whose pressure comes in bursts, e.g. JVMs collecting garbage.
+//
+// The controller is updated once every Interval seconds, from the memory stall of the interval. The stall is
+// accumulated by the policy itself, so resizes in the middle of an interval don't truncate it. The error is
+// the deviation of the stall from the target pressure, relative to it: 1 means twice the target pressure,
+// -1 means no pressure. The output is clamped to MaxInc and MaxDec, and the integral term stops accumulating while
+// the output is clamped and is bounded by MaxInc and MaxDec, so it doesn't wind up during long periods of pressure.
+type PIDPolicy struct{}
+
+func (p *PIDPolicy) Recommend(s *Stats) Recommendation {
+	pid := &s.Mem.PID
+
+	if !pid.Started {
+		pid.Started = true
+		pid.Ticks = 0
+		pid.StartTotal = s.Mem.PrevTotal
+		return Recommendation{Signal: SignalMemPressure}
+	}
+
+	pid.Ticks += 1
+	if pid.Ticks < s.Mem.Interval {
+		return Recommendation{Signal: SignalMemPressure}
+	}
+
+	stall := s.Mem.PrevTotal - pid.StartTotal
+	if s.Mem.PrevTotal < pid.StartTotal {
+		// the counters were reset when the container restarted.
+		stall = s.Mem.PrevTotal
+	}
+	// start the next interval.
+	pid.Ticks = 0
+	pid.StartTotal = s.Mem.PrevTotal
+
+	target := float64(max(1, s.Mem.TargetPressure))
+	e := (float64(stall) - target) / target
+
+	derivative := e - pid.PrevError
+	pid.PrevError = e
+
+	integral := pid.Integral + e
+	out := s.Mem.PIDKp*e + s.Mem.PIDKi*integral + s.Mem.PIDKd*derivative
+
+	clamped := min(max(out, -s.Mem.MaxDec), s.Mem.MaxInc)
+	// anti-windup: don't integrate the error pushing the output further into saturation.
+	if out == clamped || (out > clamped) != (e > 0) {
+		pid.Integral = integral
+	}
+	if s.Mem.PIDKi > 0 {
+		// the integral term alone never goes beyond the output bounds.
+		pid.Integral = min(max(pid.Integral, -s.Mem.MaxDec/s.Mem.PIDKi), s.Mem.MaxInc/s.Mem.PIDKi)
+	}
+
+	return Recommendation{Factor: clamped, Signal: SignalMemPressure}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+)
+
+func TestAdjustResetsPatchedIntegral(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, _ := newTestReconciler(t, pod)
+	s := r.CStats["app"]
+	s.Mem.Integral, s.Cpu.Integral = 1_000, 2_000
+
+	// a cpu only resize keeps the memory integral.
+	err := r.Adjust(context.Background(), pod, "app", 0, 0.2)
+	if err != nil {
+		t.Fatalf("Adjust() error = %s", err)
+	}
+	if s.Mem.Integral != 1_000 || s.Cpu.Integral != 0 {
+		t.Errorf("integrals = %d, %d, want 1000, 0", s.Mem.Integral, s.Cpu.Integral)
+	}
+}
+
+func TestPIDPolicy(t *testing.T) {
+	// totalsFrom returns n totals of memory stall growing by stall every interval.
+	totalsFrom := func(n int, stall uint64) []uint64 {
+		totals := make([]uint64, n)
+		for i := range totals {
+			totals[i] = uint64(i) * stall
+		}
+		return totals
+	}
+
+	tests := []struct {
+		name         string
+		interval     uint64
+		kp, ki, kd   float64
+		totals       []uint64
+		wantFactor   float64
+		wantIntegral float64
+	}{
+		// the first total starts the interval, the error is relative to the target pressure of 1000.
+		{name: "positive error", interval: 1, kp: 0.1, totals: []uint64{0, 2_000}, wantFactor: 0.1, wantIntegral: 1},
+		{name: "negative error", interval: 1, kp: 0.01, totals: []uint64{0, 0}, wantFactor: -0.01, wantIntegral: -1},
+		{name: "at target", interval: 1, kp: 0.1, totals: []uint64{0, 1_000}, wantFactor: 0, wantIntegral: 0},
+		{name: "interval", interval: 3, kp: 0.1, totals: []uint64{0, 1_000, 2_000, 3_000}, wantFactor: 0.2, wantIntegral: 2},
+		{name: "restarted container", interval: 1, kp: 0.1, totals: []uint64{5_000, 2_000}, wantFactor: 0.1, wantIntegral: 1},
+		{name: "derivative", interval: 1, kd: 0.01, totals: []uint64{0, 1_000, 3_000}, wantFactor: 0.01, wantIntegral: 1},
+		// the output is clamped to MaxInc and MaxDec, the error pushing it further is not integrated.
+		{name: "clamped increase", interval: 1, kp: 1, totals: []uint64{0, 11_000}, wantFactor: 0.5, wantIntegral: 0},
+		{name: "clamped decrease", interval: 1, kp: 1, totals: []uint64{0, 0}, wantFactor: -0.02, wantIntegral: 0},
+		// the integral stops at MaxInc / Ki during a long period of pressure.
+		{name: "saturated integral", interval: 1, ki: 0.1, totals: totalsFrom(11, 2_000), wantFactor: 0.5, wantIntegral: 5},
+		// the output decreases on the first interval without pressure instead of unwinding a large integral.
+		{name: "windup recovery", interval: 1, ki: 0.1, totals: append(totalsFrom(11, 2_000), 20_000), wantFactor: 0.4, wantIntegral: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Stats{Mem: Memory{MemoryConfig: MemoryConfig{
+				TargetPressure: 1_000,
+				Interval:       tt.interval,
+				MaxInc:         DefaultMemMaxInc,
+				MaxDec:         DefaultMemMaxDec,
+				PIDKp:          tt.kp,
+				PIDKi:          tt.ki,
+				PIDKd:          tt.kd,
+			}}}
+
+			var rec Recommendation
+			for _, total := range tt.totals {
+				s.Mem.PrevTotal = total
+				rec = (&PIDPolicy{}).Recommend(s)
+			}
+
+			if math.Abs(rec.Factor-tt.wantFactor) > 1e-9 {
+				t.Errorf("factor = %v, want %v", rec.Factor, tt.wantFactor)
+			}
+			if math.Abs(s.Mem.PID.Integral-tt.wantIntegral) > 1e-9 {
+				t.Errorf("integral = %v, want %v", s.Mem.PID.Integral, tt.wantIntegral)
+			}
+		})
+	}
+}
+
+func TestPIDPolicyStallAcrossResize(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, source := newTestReconciler(t, pod)
+	container := pod.Spec.Containers[0]
+	s := r.CStats["app"]
+	s.Mem.Interval, s.Mem.TargetPressure = 2, 1_000
+	s.Mem.PIDKp, s.Mem.PIDKi, s.Mem.PIDKd = 0.1, 0, 0
+	start := time.Now()
+
+	var rec Recommendation
+	for i, total := range []uint64{0, 1_000, 2_000} {
+		source.Set("app", Sample{
+			MemPressure: cgroup.PSI{Some: cgroup.PSILine{Total: total}},
+			T:           start.Add(time.Duration(i) * time.Second),
+		})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("UpdateStats() error = %s", err)
+		}
+		rec = (&PIDPolicy{}).Recommend(s)
+
+		// a resize in the middle of the interval resets the pressure integral.
+		if i == 1 {
+			if err := r.Adjust(context.Background(), pod, "app", 0.2, 0); err != nil {
+				t.Fatalf("Adjust() error = %s", err)
+			}
+			if s.Mem.Integral != 0 {
+				t.Fatalf("integral = %d after the resize, want 0", s.Mem.Integral)
+			}
+		}
+	}
+
+	// the pid controller still sees the stall of the whole interval.
+	if s.Mem.Integral != 1_000 {
+		t.Errorf("integral = %d, want %d", s.Mem.Integral, 1_000)
+	}
+	if math.Abs(rec.Factor-0.1) > 1e-9 {
+		t.Errorf("factor = %v, want %v", rec.Factor, 0.1)
+	}
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"math"
+)
+
+// TMOPolicy sizes memory to keep the memory pressure of the container near its target pressure, like Meta
+// Transparent Memory Offloading. The limit is raised as soon as the pressure is above the target, and tightened
+// every Interval seconds while it is below.
+type TMOPolicy struct{}
+
+func (p *TMOPolicy) Recommend(s *Stats) Recommendation {
+	if s.Mem.Integral > s.Mem.TargetPressure {
+		// Increase exponentially as we deviate from the target pressure.
+		diff := s.Mem.Integral / max(1, s.Mem.TargetPressure)
+		adj := math.Pow(float64(diff)/s.Mem.CoeffInc, 2)
+		adj = min(adj*s.Mem.MaxInc, s.Mem.MaxInc)
+
+		s.Mem.GraceTicks = s.Mem.Interval - 1
+		return Recommendation{Factor: adj, Signal: SignalMemPressure}
+	}
+
+	// tighten the limit when grace ticks goes to 0.
+	if s.Mem.GraceTicks > 0 {
+		s.Mem.GraceTicks -= 1
+		return Recommendation{Signal: SignalMemPressure}
+	}
+
+	// tighten the limit.
+	diff := s.Mem.TargetPressure / max(s.Mem.Integral, 1)
+	adj := math.Pow(float64(diff)/s.Mem.CoeffDec, 2)
+	adj = min(adj*s.Mem.MaxDec, s.Mem.MaxDec)
+
+	s.Mem.GraceTicks = s.Mem.Interval - 1
+	return Recommendation{Factor: -adj, Signal: SignalMemPressure}
+}
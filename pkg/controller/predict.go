@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PredictMemory returns the memory factor of the container when its memory is predictive. The limit is raised to the
+// working set expected within the lookahead plus the predictive headroom, and the reactive factor applies on top.
+func (r *Reconciler) PredictMemory(container corev1.Container, factor float64) float64 {
+	s := r.CStats[container.Name]
+	if !s.Mem.Predictive || s.Mem.Limit <= 0 {
+		return factor
+	}
+
+	peak, ok := s.Mem.Profile.PredictPeak(s.LastUpdate, time.Duration(s.Mem.PredictiveLookahead)*time.Second)
+	if !ok {
+		return factor
+	}
+
+	predicted := peak*(1+s.Mem.PredictiveHeadroom)/float64(s.Mem.Limit) - 1
+	adj := predict(predicted, factor, s.Mem.MaxInc)
+	if adj != factor {
+		s.Mem.Signal = SignalPrediction
+	}
+
+	return adj
+}
+
+// PredictCPU returns the cpu factor of the container when its cpu is predictive. The limit is raised so the cpu
+// average expected within the lookahead is at the target average of the limit, and the reactive factor applies on top.
+func (r *Reconciler) PredictCPU(container corev1.Container, factor float64) float64 {
+	s := r.CStats[container.Name]
+	if !s.Cpu.Predictive || s.Cpu.Limit <= 0 {
+		return factor
+	}
+
+	peak, ok := s.Cpu.Profile.PredictPeak(s.LastUpdate, time.Duration(s.Cpu.PredictiveLookahead)*time.Second)
+	if !ok {
+		return factor
+	}
+
+	predicted := peak/max(0.1, s.Cpu.TargetAvg)/float64(s.Cpu.Limit) - 1
+	adj := predict(predicted, factor, s.Cpu.MaxInc)
+	if adj != factor {
+		s.Cpu.Signal = SignalPrediction
+	}
+
+	return adj
+}
+
+// predict combines the factor reaching the predicted need with the reactive factor. An increase of the reactive
+// factor applies on top of the predicted increase, and a decrease can't go below the predicted need.
+// The result is at most maxInc.
+func predict(predicted, reactive, maxInc float64) float64 {
+	if reactive > 0 {
+		return min((1+max(predicted, 0))*(1+reactive)-1, maxInc)
+	}
+
+	return min(max(predicted, reactive), maxInc)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPredict(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicted float64
+		reactive  float64
+		want      float64
+	}{
+		{name: "predicted increase", predicted: 0.2, want: 0.2},
+		// an increase of the policy applies on top of the predicted increase.
+		{name: "increase on top", predicted: 0.2, reactive: 0.1, want: 0.32},
+		{name: "increase above the prediction", predicted: -0.3, reactive: 0.1, want: 0.1},
+		// a decrease of the policy can't go below the predicted need.
+		{name: "decrease above the prediction", predicted: -0.3, reactive: -0.1, want: -0.1},
+		{name: "decrease below the prediction", predicted: -0.05, reactive: -0.1, want: -0.05},
+		{name: "decrease before a peak", predicted: 0.2, reactive: -0.1, want: 0.2},
+		// the result is at most maxInc.
+		{name: "clamped prediction", predicted: 0.8, want: 0.5},
+		{name: "clamped increase on top", predicted: 0.4, reactive: 0.2, want: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := predict(tt.predicted, tt.reactive, 0.5); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("predict(%v, %v) = %v, want %v", tt.predicted, tt.reactive, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictMemory(t *testing.T) {
+	tests := []struct {
+		name       string
+		peak       float64
+		headroom   float64
+		factor     float64
+		want       float64
+		wantSignal Signal
+	}{
+		// the limit is raised to the peak plus the headroom.
+		{name: "headroom", peak: 100_000_000, headroom: 0.1, want: 0.1, wantSignal: SignalPrediction},
+		{name: "no headroom", peak: 100_000_000, want: 0, wantSignal: SignalMemPressure},
+		{name: "increase on top", peak: 100_000_000, headroom: 0.1, factor: 0.2, want: 0.32, wantSignal: SignalPrediction},
+		{name: "decrease floored", peak: 100_000_000, headroom: 0.1, factor: -0.02, want: 0.1, wantSignal: SignalPrediction},
+		// the policy decreases the memory when the peak plus the headroom is far below the limit.
+		{name: "decrease below the limit", peak: 50_000_000, headroom: 0.1, factor: -0.02, want: -0.02, wantSignal: SignalMemPressure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+			r, _ := newTestReconciler(t, pod)
+			s := r.CStats["app"]
+			s.Mem.Predictive = true
+			s.Mem.PredictiveHeadroom = tt.headroom
+			s.Mem.PredictiveLookahead = 3600
+			s.Mem.Signal = SignalMemPressure
+			s.LastUpdate = saturday
+			s.Mem.Profile.Hourly[saturday.Hour()] = ProfileSlot{Peak: tt.peak, Count: ProfileMinDays}
+
+			got := r.PredictMemory(pod.Spec.Containers[0], tt.factor)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("PredictMemory() = %v, want %v", got, tt.want)
+			}
+			if s.Mem.Signal != tt.wantSignal {
+				t.Errorf("signal = %s, want %s", s.Mem.Signal, tt.wantSignal)
+			}
+		})
+	}
+}
+
+func TestPredictMemoryNotLearned(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, _ := newTestReconciler(t, pod)
+	s := r.CStats["app"]
+	s.Mem.Predictive = true
+	s.LastUpdate = saturday.Add(-time.Hour)
+
+	// the factor of the policy is kept until the profile learned the hours of the lookahead.
+	s.Mem.Profile.Hourly[saturday.Hour()] = ProfileSlot{Peak: 200_000_000, Count: ProfileMinDays - 1}
+	if got := r.PredictMemory(pod.Spec.Containers[0], -0.02); got != -0.02 {
+		t.Errorf("PredictMemory() = %v, want %v", got, -0.02)
+	}
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"time"
+)
+
+const (
+	// ProfileSmoothing is the weight of the peak of the last hour in a ProfileSlot, the older peaks weighting the rest.
+	ProfileSmoothing float64 = 0.3
+	// ProfileMinDays is the number of days a slot of the hourly profile is learned before it is used.
+	ProfileMinDays uint64 = 2
+	// ProfileMinWeeks is the number of weeks a slot of the weekly profile is learned before it is used.
+	ProfileMinWeeks uint64 = 2
+)
+
+// Profile learns the daily and weekly seasonality of the usage of a resource of a container: the peak usage of
+// each hour of the day, and of each hour of each day of the week. Hours are in UTC.
+type Profile struct {
+	// Hourly are the peaks of each hour of the day.
+	Hourly [24]ProfileSlot
+	// Weekly are the peaks of each hour of the week, from Sunday 00:00 to Saturday 23:00.
+	Weekly [7 * 24]ProfileSlot
+
+	// Hour is the start of the hour being recorded.
+	Hour time.Time
+	// Peak is the peak usage of the hour being recorded.
+	Peak float64
+}
+
+// ProfileSlot is the smoothed peak usage of an hour.
+type ProfileSlot struct {
+	Peak float64
+	// Count is the number of hours the slot learned.
+	Count uint64
+}
+
+// Add records the usage v at time t. The peak of an hour is learned once the hour is over.
+func (p *Profile) Add(v float64, t time.Time) {
+	hour := t.UTC().Truncate(time.Hour)
+	if !hour.Equal(p.Hour) {
+		if !p.Hour.IsZero() {
+			p.learn()
+		}
+		p.Hour = hour
+		p.Peak = 0
+	}
+
+	p.Peak = max(p.Peak, v)
+}
+
+// learn adds the peak of the recorded hour to its slots.
+func (p *Profile) learn() {
+	h := p.Hour.Hour()
+	d := int(p.Hour.Weekday())
+
+	p.Hourly[h].learn(p.Peak)
+	p.Weekly[d*24+h].learn(p.Peak)
+}
+
+func (s *ProfileSlot) learn(peak float64) {
+	if s.Count == 0 {
+		s.Peak = peak
+	} else {
+		s.Peak = ProfileSmoothing*peak + (1-ProfileSmoothing)*s.Peak
+	}
+	s.Count += 1
+}
+
+// Predict returns the expected peak usage of the hour of t. The weekly profile is used once it learned the hour,
+// the hourly profile before. It returns false when neither learned it yet.
+func (p *Profile) Predict(t time.Time) (float64, bool) {
+	t = t.UTC()
+	h := t.Hour()
+	d := int(t.Weekday())
+
+	if w := p.Weekly[d*24+h]; w.Count >= ProfileMinWeeks {
+		return w.Peak, true
+	}
+	if hr := p.Hourly[h]; hr.Count >= ProfileMinDays {
+		return hr.Peak, true
+	}
+
+	return 0, false
+}
+
+// PredictPeak returns the highest expected peak usage of the hours from t to t + lookahead, so resources are raised
+// before the peak. Every hour of the window is predicted, so a short peak inside a long lookahead isn't missed.
+func (p *Profile) PredictPeak(t time.Time, lookahead time.Duration) (float64, bool) {
+	end := t.Add(lookahead)
+
+	peak, found := 0.0, false
+	for h := t.Truncate(time.Hour); !h.After(end); h = h.Add(time.Hour) {
+		if v, ok := p.Predict(h); ok {
+			peak, found = max(peak, v), true
+		}
+	}
+
+	return peak, found
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+// Saturday 6 January 2024, the hour before the week of the profile starts again.
+var saturday = time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC)
+
+func TestProfileAdd(t *testing.T) {
+	p := &Profile{}
+	p.Add(100, saturday.Add(10*time.Minute))
+	p.Add(300, saturday.Add(50*time.Minute))
+
+	// the peak of an hour is learned once the hour is over.
+	if p.Hourly[23].Count != 0 {
+		t.Fatalf("hour 23 learned before it is over")
+	}
+	p.Add(50, saturday.Add(65*time.Minute))
+
+	if got := p.Hourly[23]; got.Peak != 300 || got.Count != 1 {
+		t.Errorf("hourly slot 23 = %+v, want peak 300, count 1", got)
+	}
+	if got := p.Weekly[6*24+23]; got.Peak != 300 || got.Count != 1 {
+		t.Errorf("weekly slot of Saturday 23:00 = %+v, want peak 300, count 1", got)
+	}
+	if !p.Hour.Equal(saturday.Add(time.Hour)) || p.Peak != 50 {
+		t.Errorf("recorded hour = %s with peak %v, want %s with peak 50", p.Hour, p.Peak, saturday.Add(time.Hour))
+	}
+
+	// the hours are in UTC, Saturday 01:10 in UTC+2 is Friday 23:10 UTC.
+	p = &Profile{}
+	utc2 := time.FixedZone("UTC+2", 2*60*60)
+	p.Add(100, time.Date(2024, 1, 6, 1, 10, 0, 0, utc2))
+	p.Add(100, time.Date(2024, 1, 6, 2, 10, 0, 0, utc2))
+	if got := p.Weekly[5*24+23]; got.Count != 1 {
+		t.Errorf("weekly slot of Friday 23:00 = %+v, want count 1", got)
+	}
+
+	// the older peaks of a slot weight 1 - ProfileSmoothing.
+	p = &Profile{}
+	p.Add(100, saturday)
+	p.Add(200, saturday.Add(24*time.Hour))
+	p.Add(0, saturday.Add(25*time.Hour))
+	if got, want := p.Hourly[23].Peak, ProfileSmoothing*200+(1-ProfileSmoothing)*100; got != want || p.Hourly[23].Count != 2 {
+		t.Errorf("hourly slot 23 = %+v, want peak %v, count 2", p.Hourly[23], want)
+	}
+}
+
+func TestProfilePredict(t *testing.T) {
+	tests := []struct {
+		name   string
+		hourly ProfileSlot
+		weekly ProfileSlot
+		want   float64
+		wantOK bool
+	}{
+		{name: "not learned"},
+		// a slot is used once it learned ProfileMinDays days or ProfileMinWeeks weeks.
+		{name: "hourly too short", hourly: ProfileSlot{Peak: 100, Count: ProfileMinDays - 1}},
+		{name: "hourly", hourly: ProfileSlot{Peak: 100, Count: ProfileMinDays}, want: 100, wantOK: true},
+		{name: "weekly too short", hourly: ProfileSlot{Peak: 100, Count: ProfileMinDays}, weekly: ProfileSlot{Peak: 200, Count: ProfileMinWeeks - 1}, want: 100, wantOK: true},
+		{name: "weekly", hourly: ProfileSlot{Peak: 100, Count: ProfileMinDays}, weekly: ProfileSlot{Peak: 200, Count: ProfileMinWeeks}, want: 200, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Profile{}
+			p.Hourly[23] = tt.hourly
+			p.Weekly[6*24+23] = tt.weekly
+
+			got, ok := p.Predict(saturday.Add(30 * time.Minute))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Predict() = %v, %t, want %v, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProfilePredictPeak(t *testing.T) {
+	p := &Profile{}
+	p.Hourly[22] = ProfileSlot{Peak: 100, Count: ProfileMinDays}
+	p.Hourly[0] = ProfileSlot{Peak: 800, Count: ProfileMinDays}
+	// the peak of Sunday 00:00 is learned by the weekly profile.
+	p.Weekly[0] = ProfileSlot{Peak: 1_000, Count: ProfileMinWeeks}
+
+	monday := time.Date(2024, 1, 8, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		lookahead time.Duration
+		want      float64
+		wantOK    bool
+	}{
+		{name: "current hour", t: monday, want: 100, wantOK: true},
+		{name: "hour not learned", t: monday.Add(time.Hour)},
+		{name: "lookahead before midnight", t: monday, lookahead: time.Hour, want: 100, wantOK: true},
+		// the peak after midnight is predicted from 23:30.
+		{name: "lookahead across midnight", t: monday, lookahead: 90 * time.Minute, want: 800, wantOK: true},
+		{name: "lookahead across the week", t: saturday.Add(30 * time.Minute), lookahead: time.Hour, want: 1_000, wantOK: true},
+		// a short peak inside a long lookahead is not missed.
+		{name: "long lookahead", t: monday.Add(-12 * time.Hour), lookahead: 24 * time.Hour, want: 800, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.PredictPeak(tt.t, tt.lookahead)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("PredictPeak() = %v, %t, want %v, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
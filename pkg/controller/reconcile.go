@@ -2,67 +2,173 @@ package controller
 
 import (
 	"context"
-	"net/http"
+	"errors"
+	"fmt"
 	"slices"
 	"sync"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/unagex/kondense/pkg/utils"
 	corev1 "k8s.io/api/core/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 type Reconciler struct {
-	Client    *kubernetes.Clientset
-	RawClient *http.Client
+	Client kubernetes.Interface
+	// Recorder records the resize decisions as events on the pod. Events are not recorded when it is nil.
+	Recorder record.EventRecorder
 
-	Mu          sync.Mutex
-	BearerToken string
+	Mu sync.Mutex
 
 	Namespace string
 	Name      string
 
+	Source StatsSource
+
+	// ConfigDir is where a ConfigMap configuring the containers is mounted. It is optional.
+	ConfigDir string
+	// LookupEnv looks up the environment variables configuring the containers. It defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+	// configFiles are the files of ConfigDir, keyed by file name.
+	configFiles map[string]string
+	// configVersion changes when the configuration of the containers changes.
+	configVersion string
+	// configErrors are the problems of the configuration of each container.
+	configErrors map[string][]error
+
 	CStats ContainerStats
+
+	// StateFile is where the stats of the containers are saved every tick and restored from on startup,
+	// e.g. in an emptyDir volume. The stats are not saved when it is empty.
+	StateFile string
+	// restored are the stats read from StateFile, until InitCStats uses them.
+	restored ContainerStats
+	// stateRestored is true once StateFile was read.
+	stateRestored bool
+	// stopped is true once the pod is not kondensed anymore, e.g. it was deleted. The state is not saved anymore.
+	stopped bool
+
+	// ResizeSubresource is true when pods are resized through the pods/resize subresource.
+	ResizeSubresource bool
+	Resize            Resize
+
+	// pod is the latest version of the pod from the watch. podChanged is true when it changed since the last tick.
+	pod        *corev1.Pod
+	podChanged bool
+
+	// lastTick is when the last tick of the reconcile loop finished.
+	lastTick time.Time
+	// notReady is why kondense is not ready, empty when it is ready.
+	notReady string
 }
 
-func (r *Reconciler) Reconcile() {
+var (
+	// ErrBestEffort is returned by Tick for pods with a QoS class of BestEffort, they have no resources to resize.
+	ErrBestEffort = errors.New("error kondense is only allowed for pods with a QoS class of Guaranteed or Burstable")
+	// ErrPodCompleted is returned by Tick when the containers of a pod that is not restarted exited, e.g. a Job.
+	ErrPodCompleted = errors.New("pod completed")
+)
+
+// Reconcile resizes the containers of the pod of the reconciler every second, until ctx is done
+// or the pod completed. It returns an error when it stopped for another reason.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
 	r.CStats = ContainerStats{}
+	r.ResizeSubresource = r.SupportsResizeSubresource()
+
+	// don't report kondense unhealthy while the informer syncs.
+	r.Mu.Lock()
+	r.lastTick = time.Now()
+	r.notReady = "pod not synced yet"
+	r.Mu.Unlock()
+
+	err := r.WatchPod(ctx)
+	if err != nil {
+		return fmt.Errorf("error failed to watch pod: %w", err)
+	}
 
 	var start time.Time
 	var loopTime time.Duration
 	for {
 		// one iteration should take 1 second.
-		time.Sleep(time.Second - loopTime)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second - loopTime):
+		}
 		start = time.Now()
 
-		pod, err := r.Client.CoreV1().Pods(r.Namespace).Get(context.TODO(), r.Name, v1.GetOptions{})
-		if err != nil {
-			log.Error().Err(err)
-			continue
+		err := r.Tick(ctx)
+		if errors.Is(err, ErrPodCompleted) {
+			// let the Job complete.
+			r.logger().Info().Msg("containers exited, stopping kondense")
+			return nil
 		}
-		if pod.Status.QOSClass != corev1.PodQOSGuaranteed {
-			log.Error().Msgf("error kondense is only allowed for pods with a QoS class of Guaranteed, got: %s.", pod.Status.QOSClass)
-			break
+		if errors.Is(err, ErrBestEffort) {
+			return err
+		}
+		if err != nil {
+			r.logger().Error().Err(err).Msg("failed to reconcile pod")
 		}
 
-		r.InitCStats(pod)
+		loopTime = time.Since(start)
+	}
+}
 
-		var wg sync.WaitGroup
-		wg.Add(len(pod.Spec.Containers))
+// Tick runs one iteration of the reconcile loop on the latest version of the pod:
+// it updates the stats of every container and resizes them when needed.
+func (r *Reconciler) Tick(ctx context.Context) error {
+	pod, changed := r.Pod()
+	if pod == nil {
+		return fmt.Errorf("error pod %s not found", r.Name)
+	}
+	if qos := QOSClass(pod); qos == corev1.PodQOSBestEffort {
+		return fmt.Errorf("%w, got: %s", ErrBestEffort, qos)
+	}
+	if completed(pod) {
+		return ErrPodCompleted
+	}
 
-		for _, container := range pod.Spec.Containers {
-			go r.ReconcileContainer(pod, container, &wg)
+	if r.CStats == nil {
+		r.CStats = ContainerStats{}
+	}
+
+	r.WatchConfig(pod)
+	if !r.stateRestored {
+		r.stateRestored = true
+		err := r.RestoreState(pod)
+		if err != nil {
+			r.logger().Error().Err(err).Str("file", r.StateFile).Msg("failed to restore state")
 		}
+	}
+	if changed {
+		r.InitCStats(pod)
+	}
+	r.UpdateResize(pod)
 
-		wg.Wait()
+	containers := ManagedContainers(pod, r.ResizeSubresource)
 
-		loopTime = time.Since(start)
+	var wg sync.WaitGroup
+	wg.Add(len(containers))
+
+	for _, container := range containers {
+		go r.ReconcileContainer(ctx, pod, container, &wg)
+	}
+
+	wg.Wait()
+	r.endTick(pod)
+
+	err := r.SaveState(pod)
+	if err != nil {
+		r.logger().Error().Err(err).Str("file", r.StateFile).Msg("failed to save state")
 	}
+
+	return nil
 }
 
-func (r *Reconciler) ReconcileContainer(pod *corev1.Pod, container corev1.Container, wg *sync.WaitGroup) {
+func (r *Reconciler) ReconcileContainer(ctx context.Context, pod *corev1.Pod, container corev1.Container, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	exclude := utils.ContainersToExclude()
@@ -70,14 +176,31 @@ func (r *Reconciler) ReconcileContainer(pod *corev1.Pod, container corev1.Contai
 		return
 	}
 
-	err := r.UpdateStats(pod, container)
+	// exited containers have no stats, e.g. the containers of a Job.
+	if cs, ok := containerStatus(pod, container.Name); !ok || cs.State.Running == nil {
+		return
+	}
+
+	// don't collect stats nor kondense with an invalid configuration.
+	if len(r.configErrors[container.Name]) > 0 {
+		return
+	}
+
+	err := r.UpdateStats(ctx, pod, container)
 	if err != nil {
-		log.Error().Err(err)
+		r.logger().Error().Err(err).Str("container", container.Name).Msg("failed to update stats")
+		r.Event(pod, corev1.EventTypeWarning, ReasonStatsUnreadable, "Failed to read stats of container %s: %s", container.Name, err)
 		return
 	}
 
-	err = r.KondenseContainer(container)
+	err = r.KondenseContainer(ctx, pod, container)
 	if err != nil {
-		log.Error().Err(err)
+		r.logger().Error().Err(err).Str("container", container.Name).Msg("failed to kondense container")
 	}
 }
+
+// logger returns the logger of the reconciler, with the pod in every message.
+func (r *Reconciler) logger() *zerolog.Logger {
+	l := log.With().Str("pod", r.Namespace+"/"+r.Name).Logger()
+	return &l
+}
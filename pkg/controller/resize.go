@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	// PodResizePending and PodResizeInProgress are the pod conditions reporting a resize since Kubernetes 1.33.
+	PodResizePending    corev1.PodConditionType = "PodResizePending"
+	PodResizeInProgress corev1.PodConditionType = "PodResizeInProgress"
+
+	// ResizeTimeout is how long a resize can stay pending before kondense patches again.
+	ResizeTimeout = time.Minute
+	// ResizeMinBackoff and ResizeMaxBackoff bound how long kondense waits after an infeasible resize.
+	ResizeMinBackoff = 30 * time.Second
+	ResizeMaxBackoff = 10 * time.Minute
+)
+
+// Resize tracks the last resize of the pod, from the patch until it is actuated or rejected.
+type Resize struct {
+	// Pending is true while the last resize is neither actuated nor rejected.
+	Pending bool
+	// Container is the container of the last resize.
+	Container string
+	// Since is when the last resize was patched.
+	Since time.Time
+	// ResourceVersion and Generation are the ones of the patched pod. The pod is only compared to its spec
+	// once it is at least at this version, as the watched pod can lag behind the patch.
+	ResourceVersion string
+	Generation      int64
+	// Backoff is how long kondense waits after an infeasible resize. It doubles on each infeasible resize.
+	Backoff time.Duration
+	// BackoffUntil is when kondense can patch again after an infeasible resize.
+	BackoffUntil time.Time
+}
+
+// SupportsResizeSubresource returns true when the API server has the pods/resize subresource,
+// which is required to resize pods since Kubernetes 1.33.
+func (r *Reconciler) SupportsResizeSubresource() bool {
+	v, err := r.Client.Discovery().ServerVersion()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get the API server version, patching the pod directly.")
+		return false
+	}
+
+	major, err := strconv.Atoi(strings.TrimSuffix(v.Major, "+"))
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(v.Minor, "+"))
+	if err != nil {
+		return false
+	}
+
+	log.Info().Str("version", v.GitVersion).Msg("detected API server version")
+
+	return major > 1 || (major == 1 && minor >= 33)
+}
+
+// ClaimResize marks a resize of the container as pending before it is patched, so the other containers of
+// the pod are not patched meanwhile. It returns false when the pod can't be resized, e.g. because another
+// container was just claimed.
+func (r *Reconciler) ClaimResize(containerName string) bool {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	if !r.canResize() {
+		return false
+	}
+
+	r.Resize.Pending = true
+	r.Resize.Container = containerName
+	r.Resize.Since = time.Now()
+	r.Resize.ResourceVersion = ""
+	r.Resize.Generation = 0
+
+	return true
+}
+
+// ReleaseResize releases the resize claimed when the patch failed.
+func (r *Reconciler) ReleaseResize() {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	r.Resize.Pending = false
+}
+
+// StartResize records the version of the pod patched by the claimed resize.
+func (r *Reconciler) StartResize(patched *corev1.Pod) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	r.Resize.ResourceVersion = patched.ResourceVersion
+	r.Resize.Generation = patched.Generation
+}
+
+// CanResize returns false while a resize is pending or after an infeasible resize.
+func (r *Reconciler) CanResize() bool {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	return r.canResize()
+}
+
+func (r *Reconciler) canResize() bool {
+	return !r.Resize.Pending && time.Now().After(r.Resize.BackoffUntil)
+}
+
+// UpdateResize follows the last resize with the pod status.
+func (r *Reconciler) UpdateResize(pod *corev1.Pod) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	if !r.Resize.Pending {
+		return
+	}
+
+	status, reason := resizeStatus(pod)
+	observed := resizeObserved(pod, r.Resize)
+	switch {
+	case observed && status == corev1.PodResizeStatusInfeasible:
+		r.Resize.Pending = false
+		r.Resize.Backoff = min(max(2*r.Resize.Backoff, ResizeMinBackoff), ResizeMaxBackoff)
+		r.Resize.BackoffUntil = time.Now().Add(r.Resize.Backoff)
+		r.logger().Warn().
+			Str("container", r.Resize.Container).
+			Str("reason", reason).
+			Dur("backoff", r.Resize.Backoff).
+			Msg("resize is infeasible, backing off")
+		r.Event(pod, corev1.EventTypeWarning, ReasonResizeInfeasible,
+			"Resize of container %s is infeasible: %s. Backing off for %s", r.Resize.Container, reason, r.Resize.Backoff)
+	case observed && status == "" && resizeActuated(pod):
+		r.Resize.Pending = false
+		r.Resize.Backoff = 0
+		r.logger().Info().
+			Str("container", r.Resize.Container).
+			Dur("duration", time.Since(r.Resize.Since)).
+			Msg("resize actuated")
+	case time.Since(r.Resize.Since) > ResizeTimeout:
+		r.Resize.Pending = false
+		r.logger().Warn().
+			Str("container", r.Resize.Container).
+			Str("status", string(status)).
+			Str("reason", reason).
+			Msg("resize still pending after timeout")
+	}
+}
+
+// resizeStatus returns the status of the resize of the pod, and its reason when there is one.
+// It reads the pod conditions since Kubernetes 1.33 and the deprecated pod status resize field before.
+func resizeStatus(pod *corev1.Pod) (corev1.PodResizeStatus, string) {
+	for _, c := range pod.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case PodResizePending:
+			// the reason is either Infeasible or Deferred.
+			return corev1.PodResizeStatus(c.Reason), c.Message
+		case PodResizeInProgress:
+			return corev1.PodResizeStatusInProgress, c.Message
+		}
+	}
+
+	return pod.Status.Resize, ""
+}
+
+// resizeObserved returns true when the pod is at least at the version of the pod patched by the resize.
+func resizeObserved(pod *corev1.Pod, resize Resize) bool {
+	if resize.ResourceVersion == "" || pod.Generation < resize.Generation {
+		return false
+	}
+	if pod.ResourceVersion == resize.ResourceVersion {
+		return true
+	}
+
+	// resource versions are opaque, but they are the revisions of etcd in practice.
+	v, err := strconv.ParseUint(pod.ResourceVersion, 10, 64)
+	if err != nil {
+		return false
+	}
+	patched, err := strconv.ParseUint(resize.ResourceVersion, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return v >= patched
+}
+
+// resizeActuated returns true when the requests and limits of all the containers and native sidecars are the ones of the spec.
+func resizeActuated(pod *corev1.Pod) bool {
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, container := range containers {
+			cs, ok := containerStatus(pod, container.Name)
+			if !ok || cs.Resources == nil {
+				continue
+			}
+			if !equality.Semantic.DeepEqual(container.Resources.Requests, cs.Resources.Requests) ||
+				!equality.Semantic.DeepEqual(container.Resources.Limits, cs.Resources.Limits) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
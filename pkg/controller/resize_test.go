@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAdjustOneResizeAtATime(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, _ := newTestReconciler(t, pod)
+
+	err := r.Adjust(context.Background(), pod, "app", 0.2, 0)
+	if err != nil {
+		t.Fatalf("Adjust() error = %s", err)
+	}
+	// the first resize is pending, the second is not patched.
+	err = r.Adjust(context.Background(), pod, "app", 0.4, 0)
+	if !errors.Is(err, errResizeClaimed) {
+		t.Fatalf("Adjust() error = %v, want %s", err, errResizeClaimed)
+	}
+
+	if got := patchedLimit(t, r); got != 120_000_000 {
+		t.Errorf("memory limit = %d, want %d", got, 120_000_000)
+	}
+}
+
+func TestKondenseContainerOOMKillWhileResizing(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	db := pod.Spec.Containers[0]
+	db.Name = "db"
+	pod.Spec.Containers = append(pod.Spec.Containers, db)
+	dbStatus := pod.Status.ContainerStatuses[0]
+	dbStatus.Name, dbStatus.ContainerID = "db", "containerd://db"
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, dbStatus)
+
+	r, source := newTestReconciler(t, pod)
+	container := pod.Spec.Containers[0]
+
+	for _, kills := range []uint64{0, 1} {
+		source.Set("app", Sample{MemEvents: cgroup.MemoryEvents{OOMKill: kills}})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("UpdateStats() error = %s", err)
+		}
+	}
+
+	// the container db claims the resize first, the out-of-memory kill of app is kept for the next tick.
+	graceTicks := r.CStats["app"].Mem.GraceTicks
+	if !r.ClaimResize("db") {
+		t.Fatalf("ClaimResize() = false, want true")
+	}
+	err := r.KondenseContainer(context.Background(), pod, container)
+	if err != nil {
+		t.Fatalf("KondenseContainer() error = %s", err)
+	}
+	if got := patchedLimit(t, r); got != 100_000_000 {
+		t.Errorf("memory limit = %d, want %d", got, 100_000_000)
+	}
+	if s := r.CStats["app"]; !s.Mem.OOMKilled || s.Mem.GraceTicks != graceTicks {
+		t.Errorf("out-of-memory kill = %t, grace ticks = %d, want true, %d", s.Mem.OOMKilled, s.Mem.GraceTicks, graceTicks)
+	}
+
+	r.ReleaseResize()
+	err = r.KondenseContainer(context.Background(), pod, container)
+	if err != nil {
+		t.Fatalf("KondenseContainer() error = %s", err)
+	}
+	if got := patchedLimit(t, r); got != 150_000_000 {
+		t.Errorf("memory limit = %d, want %d", got, 150_000_000)
+	}
+	if s := r.CStats["app"]; s.Mem.OOMKilled {
+		t.Errorf("out-of-memory kill still pending after the resize")
+	}
+}
+
+// resizedPod returns the test pod at resourceVersion and generation, with its resize conditions.
+// The resources of its status are the ones of the spec when actuated is true.
+func resizedPod(resourceVersion string, generation int64, actuated bool, conditions ...corev1.PodCondition) *corev1.Pod {
+	pod := testPod(resources(120_000_000, 500), resources(120_000_000, 500))
+	pod.ResourceVersion, pod.Generation = resourceVersion, generation
+	pod.Status.Conditions = conditions
+
+	status := pod.Spec.Containers[0].Resources
+	if !actuated {
+		status = corev1.ResourceRequirements{Requests: resources(100_000_000, 500), Limits: resources(100_000_000, 500)}
+	}
+	pod.Status.ContainerStatuses[0].Resources = &status
+
+	return pod
+}
+
+func TestResizeStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		conditions  []corev1.PodCondition
+		resize      corev1.PodResizeStatus
+		wantStatus  corev1.PodResizeStatus
+		wantMessage string
+	}{
+		{name: "no resize"},
+		{name: "deferred", conditions: []corev1.PodCondition{
+			{Type: PodResizePending, Status: corev1.ConditionTrue, Reason: "Deferred", Message: "Node didn't have enough capacity"},
+		}, wantStatus: corev1.PodResizeStatusDeferred, wantMessage: "Node didn't have enough capacity"},
+		{name: "infeasible", conditions: []corev1.PodCondition{
+			{Type: PodResizePending, Status: corev1.ConditionTrue, Reason: "Infeasible", Message: "Node didn't have enough allocatable"},
+		}, wantStatus: corev1.PodResizeStatusInfeasible, wantMessage: "Node didn't have enough allocatable"},
+		{name: "in progress", conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			{Type: PodResizeInProgress, Status: corev1.ConditionTrue},
+		}, wantStatus: corev1.PodResizeStatusInProgress},
+		{name: "condition not true", conditions: []corev1.PodCondition{
+			{Type: PodResizePending, Status: corev1.ConditionFalse, Reason: "Infeasible"},
+		}},
+		// before Kubernetes 1.33, the resize is reported in the status of the pod.
+		{name: "deprecated status", resize: corev1.PodResizeStatusInfeasible, wantStatus: corev1.PodResizeStatusInfeasible},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := resizedPod("10", 1, false, tt.conditions...)
+			pod.Status.Resize = tt.resize
+
+			status, message := resizeStatus(pod)
+			if status != tt.wantStatus || message != tt.wantMessage {
+				t.Errorf("resizeStatus() = %q, %q, want %q, %q", status, message, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestResizeObserved(t *testing.T) {
+	tests := []struct {
+		name            string
+		resourceVersion string
+		generation      int64
+		resize          Resize
+		want            bool
+	}{
+		{name: "patched version", resourceVersion: "10", generation: 2, resize: Resize{ResourceVersion: "10", Generation: 2}, want: true},
+		{name: "newer version", resourceVersion: "12", generation: 3, resize: Resize{ResourceVersion: "10", Generation: 2}, want: true},
+		// the watched pod can lag behind the patch.
+		{name: "older version", resourceVersion: "9", generation: 2, resize: Resize{ResourceVersion: "10", Generation: 2}},
+		{name: "older generation", resourceVersion: "12", generation: 1, resize: Resize{ResourceVersion: "10", Generation: 2}},
+		{name: "not patched yet", resourceVersion: "12", generation: 2, resize: Resize{}},
+		{name: "opaque version", resourceVersion: "b", generation: 2, resize: Resize{ResourceVersion: "a", Generation: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := resizedPod(tt.resourceVersion, tt.generation, true)
+			if got := resizeObserved(pod, tt.resize); got != tt.want {
+				t.Errorf("resizeObserved() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizeActuated(t *testing.T) {
+	if !resizeActuated(resizedPod("10", 1, true)) {
+		t.Errorf("resizeActuated() = false for the resources of the spec, want true")
+	}
+	if resizeActuated(resizedPod("10", 1, false)) {
+		t.Errorf("resizeActuated() = true for the previous resources, want false")
+	}
+
+	// the limits are compared too, e.g. for Burstable pods whose limit alone changed.
+	pod := resizedPod("10", 1, true)
+	pod.Status.ContainerStatuses[0].Resources.Limits = resources(200_000_000, 500)
+	if resizeActuated(pod) {
+		t.Errorf("resizeActuated() = true for other limits, want false")
+	}
+
+	// containers without resources in their status are not compared.
+	pod = resizedPod("10", 1, true)
+	pod.Status.ContainerStatuses[0].Resources = nil
+	if !resizeActuated(pod) {
+		t.Errorf("resizeActuated() = false without resources in the status, want true")
+	}
+}
+
+func TestUpdateResize(t *testing.T) {
+	pending := func(reason string) corev1.PodCondition {
+		return corev1.PodCondition{Type: PodResizePending, Status: corev1.ConditionTrue, Reason: reason}
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		since       time.Duration
+		backoff     time.Duration
+		wantPending bool
+		wantBackoff time.Duration
+	}{
+		{name: "actuated", pod: resizedPod("10", 2, true), backoff: ResizeMinBackoff},
+		{name: "not actuated yet", pod: resizedPod("10", 2, false), wantPending: true},
+		// the status of a pod older than the patch says nothing about the resize.
+		{name: "not observed", pod: resizedPod("9", 2, true), wantPending: true},
+		{name: "infeasible not observed", pod: resizedPod("9", 2, false, pending("Infeasible")), wantPending: true},
+		{name: "deferred", pod: resizedPod("11", 2, false, pending("Deferred")), wantPending: true},
+		{name: "in progress", pod: resizedPod("11", 2, true,
+			corev1.PodCondition{Type: PodResizeInProgress, Status: corev1.ConditionTrue}), wantPending: true},
+		// infeasible resizes back off, longer after each one.
+		{name: "infeasible", pod: resizedPod("11", 2, false, pending("Infeasible")), wantBackoff: ResizeMinBackoff},
+		{name: "infeasible again", pod: resizedPod("11", 2, false, pending("Infeasible")), backoff: ResizeMinBackoff, wantBackoff: 2 * ResizeMinBackoff},
+		{name: "infeasible max backoff", pod: resizedPod("11", 2, false, pending("Infeasible")), backoff: ResizeMaxBackoff, wantBackoff: ResizeMaxBackoff},
+		// kondense patches again after ResizeTimeout.
+		{name: "timeout", pod: resizedPod("11", 2, false, pending("Deferred")), since: ResizeTimeout + time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, tt.pod)
+			r.Resize = Resize{
+				Pending:         true,
+				Container:       "app",
+				Since:           time.Now().Add(-tt.since),
+				ResourceVersion: "10",
+				Generation:      2,
+				Backoff:         tt.backoff,
+			}
+
+			r.UpdateResize(tt.pod)
+			if r.Resize.Pending != tt.wantPending {
+				t.Errorf("pending = %t, want %t", r.Resize.Pending, tt.wantPending)
+			}
+			if !tt.wantPending && r.Resize.Backoff != tt.wantBackoff {
+				t.Errorf("backoff = %s, want %s", r.Resize.Backoff, tt.wantBackoff)
+			}
+			if canResize := r.CanResize(); canResize != (!tt.wantPending && tt.wantBackoff == 0) {
+				t.Errorf("CanResize() = %t, want %t", canResize, !tt.wantPending && tt.wantBackoff == 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	StatsSourceCgroup  = "cgroup"
+	StatsSourceExec    = "exec"
+	StatsSourceKubelet = "kubelet"
+
+	// SampleTimeout is how long a source can take to sample the stats of a container.
+	SampleTimeout = 500 * time.Millisecond
+)
+
+// statsFiles are the cgroup files read by the exec and cgroup sources.
+var statsFiles = []string{"memory.pressure", "memory.events", "memory.current", "memory.stat", "cpu.pressure", "cpu.stat"}
+
+// StatsSource gets a sample of the stats of a container in a pod. The sample is abandoned when ctx is done.
+type StatsSource interface {
+	Sample(ctx context.Context, pod *corev1.Pod, containerName string) (Sample, error)
+}
+
+// Sample is a snapshot of the cumulative stats of a container.
+type Sample struct {
+	// MemPressure is the memory pressure of the container.
+	MemPressure cgroup.PSI
+	// MemEvents are the memory events of the container, e.g. out-of-memory kills.
+	MemEvents cgroup.MemoryEvents
+	// MemUsage is the memory usage of the container in bytes, including the page cache.
+	MemUsage uint64
+	// MemWorkingSet is the memory working set of the container in bytes.
+	MemWorkingSet uint64
+	// CPUPressure is the cpu pressure of the container.
+	CPUPressure cgroup.PSI
+	// CPUStat is the cpu usage of the container.
+	CPUStat cgroup.CPUStat
+	// T is when the sample was taken.
+	T time.Time
+}
+
+// NewStatsSource returns the stats source named name. It defaults to the cgroup source.
+// self is the pod of kondense in sidecar mode, named namespace/name, and is empty in the other modes.
+func NewStatsSource(name string, config *rest.Config, client *kubernetes.Clientset, cgroupRoot, self string) (StatsSource, error) {
+	switch name {
+	case "", StatsSourceCgroup:
+		return &CgroupSource{Root: cgroupRoot, Self: self}, nil
+	case StatsSourceExec:
+		return &ExecSource{Config: config, Client: client, Self: self}, nil
+	case StatsSourceKubelet:
+		return &KubeletSource{Client: client}, nil
+	}
+
+	return nil, fmt.Errorf("error unknown stats source: %s, want one of: %s, %s, %s",
+		name, StatsSourceCgroup, StatsSourceExec, StatsSourceKubelet)
+}
+
+// newSample parses the content of the stats files of a container, keyed by file name.
+func newSample(files map[string][]byte, t time.Time) (Sample, error) {
+	memPressure, err := cgroup.ParsePSI(files["memory.pressure"])
+	if err != nil {
+		return Sample{}, fmt.Errorf("error cannot parse memory.pressure: %w", err)
+	}
+
+	memEvents, err := cgroup.ParseMemoryEvents(files["memory.events"])
+	if err != nil {
+		return Sample{}, fmt.Errorf("error cannot parse memory.events: %w", err)
+	}
+
+	memCurrent, err := cgroup.ParseMemoryCurrent(files["memory.current"])
+	if err != nil {
+		return Sample{}, err
+	}
+
+	memStat, err := cgroup.ParseMemoryStat(files["memory.stat"])
+	if err != nil {
+		return Sample{}, fmt.Errorf("error cannot parse memory.stat: %w", err)
+	}
+
+	cpuPressure, err := cgroup.ParsePSI(files["cpu.pressure"])
+	if err != nil {
+		return Sample{}, fmt.Errorf("error cannot parse cpu.pressure: %w", err)
+	}
+
+	cpuStat, err := cgroup.ParseCPUStat(files["cpu.stat"])
+	if err != nil {
+		return Sample{}, fmt.Errorf("error cannot parse cpu.stat: %w", err)
+	}
+
+	return Sample{
+		MemPressure:   memPressure,
+		MemEvents:     memEvents,
+		MemUsage:      memCurrent,
+		MemWorkingSet: cgroup.WorkingSet(memCurrent, memStat),
+		CPUPressure:   cpuPressure,
+		CPUStat:       cpuStat,
+		T:             t,
+	}, nil
+}
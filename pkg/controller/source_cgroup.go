@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultCgroupPath is where the cgroup hierarchy of a container is mounted inside the container.
+	DefaultCgroupPath = "/sys/fs/cgroup"
+	// DefaultHostCgroupRoot is where the node agent expects the cgroup hierarchy of the node to be mounted.
+	DefaultHostCgroupRoot = "/host/sys/fs/cgroup"
+)
+
+// CgroupSource reads the cgroup files of each container directly.
+//
+// The cgroup directory of a container is found either in the cgroup hierarchy mounted at Root,
+// by pod uid and container id, or through the /proc of one of its processes when the pod has
+// a shared process namespace.
+type CgroupSource struct {
+	// Root is where the cgroup hierarchy of the node is mounted. When empty, /proc is used.
+	Root string
+	// Self is the pod of kondense in sidecar mode, named namespace/name. Its kondense container is read directly.
+	Self string
+
+	mu sync.Mutex
+	// dirs caches the cgroup directory of each container, keyed by container id.
+	dirs map[string]string
+}
+
+func (c *CgroupSource) Sample(_ context.Context, pod *corev1.Pod, containerName string) (Sample, error) {
+	dir, err := c.cgroupDir(pod, containerName)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	output, err := readFiles(dir, statsFiles)
+	if err != nil {
+		// the process or the cgroup may be gone, look it up again.
+		c.mu.Lock()
+		for id, d := range c.dirs {
+			if d == dir {
+				delete(c.dirs, id)
+			}
+		}
+		c.mu.Unlock()
+		return Sample{}, err
+	}
+
+	return newSample(output, time.Now())
+}
+
+// readFiles returns the content of the files in dir, keyed by file name.
+func readFiles(dir string, files []string) (map[string][]byte, error) {
+	output := make(map[string][]byte, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		output[f] = b
+	}
+
+	return output, nil
+}
+
+func (c *CgroupSource) cgroupDir(pod *corev1.Pod, containerName string) (string, error) {
+	// kondense can read its own cgroup directly, unless it reads the cgroups of the node.
+	if c.Root == "" && isSelf(c.Self, pod, containerName) {
+		return DefaultCgroupPath, nil
+	}
+
+	// a restarted container has a new id, and so a new cgroup.
+	id, err := containerID(pod, containerName)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	dir, ok := c.dirs[id]
+	c.mu.Unlock()
+	if ok {
+		return dir, nil
+	}
+
+	if c.Root != "" {
+		dir, err = findPodCgroupDir(c.Root, pod, id)
+		if err != nil {
+			dir, err = findCgroupDir(c.Root, id)
+		}
+	} else {
+		dir, err = findProcCgroupDir(id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	if c.dirs == nil {
+		c.dirs = map[string]string{}
+	}
+	c.dirs[id] = dir
+	c.mu.Unlock()
+
+	return dir, nil
+}
+
+// containerID returns the runtime id of a container, without the runtime prefix (e.g. containerd://).
+func containerID(pod *corev1.Pod, containerName string) (string, error) {
+	cs, ok := containerStatus(pod, containerName)
+	if !ok {
+		return "", fmt.Errorf("error container %s not found in pod status", containerName)
+	}
+
+	_, id, found := strings.Cut(cs.ContainerID, "://")
+	if !found || id == "" {
+		return "", fmt.Errorf("error container %s has no container id yet", containerName)
+	}
+
+	return id, nil
+}
+
+// findPodCgroupDir looks for the directory of the container with this id in the kubepods hierarchy,
+// under the directory of its pod. Pod directories are named after the QoS class and the uid of the pod,
+// e.g. kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice with the systemd cgroup
+// driver or kubepods/burstable/pod<uid> with the cgroupfs cgroup driver.
+func findPodCgroupDir(root string, pod *corev1.Pod, id string) (string, error) {
+	uid := string(pod.UID)
+	qos := strings.ToLower(string(pod.Status.QOSClass))
+
+	var podDirs []string
+	if qos == "" || qos == "guaranteed" {
+		podDirs = append(podDirs,
+			filepath.Join("kubepods.slice", "kubepods-pod"+strings.ReplaceAll(uid, "-", "_")+".slice"),
+			filepath.Join("kubepods", "pod"+uid),
+		)
+	} else {
+		podDirs = append(podDirs,
+			filepath.Join("kubepods.slice", "kubepods-"+qos+".slice", "kubepods-"+qos+"-pod"+strings.ReplaceAll(uid, "-", "_")+".slice"),
+			filepath.Join("kubepods", qos, "pod"+uid),
+		)
+	}
+
+	for _, podDir := range podDirs {
+		entries, err := os.ReadDir(filepath.Join(root, podDir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() && strings.Contains(e.Name(), id) {
+				return filepath.Join(root, podDir, e.Name()), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("error cgroup of container %s not found in the kubepods hierarchy of %s", id, root)
+}
+
+// findCgroupDir walks a mounted cgroup hierarchy to find the directory of the container with this id.
+// Container cgroups are named after the container id, e.g. cri-containerd-<id>.scope or <id>.
+func findCgroupDir(root, id string) (string, error) {
+	var dir string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// cgroups can disappear while walking.
+			return nil
+		}
+		if d.IsDir() && strings.Contains(d.Name(), id) {
+			dir = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", fmt.Errorf("error cgroup of container %s not found in %s", id, root)
+	}
+
+	return dir, nil
+}
+
+// findProcCgroupDir looks for a process of the container with this id in /proc.
+// It needs the pod to share its process namespace. The cgroup files are then read
+// through the root filesystem of the process.
+func findProcCgroupDir(id string) (string, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || strings.Trim(e.Name(), "0123456789") != "" {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cgroup"))
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(string(b), id) {
+			continue
+		}
+
+		dir := filepath.Join("/proc", e.Name(), "root", DefaultCgroupPath)
+		if _, err := os.Stat(dir); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return "", fmt.Errorf("error cannot access cgroup of container %s, kondense needs the SYS_PTRACE capability: %w", id, err)
+			}
+			continue
+		}
+		return dir, nil
+	}
+
+	return "", fmt.Errorf("error no process found for container %s, the pod should have shareProcessNamespace set to true", id)
+}
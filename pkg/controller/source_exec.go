@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecSource reads the cgroup files by executing head in each container.
+// It needs the pods/exec permission and the containers should have a head binary.
+type ExecSource struct {
+	Config *rest.Config
+	Client *kubernetes.Clientset
+	// Self is the pod of kondense in sidecar mode, named namespace/name. Its kondense container is read directly.
+	Self string
+}
+
+func (e *ExecSource) Sample(ctx context.Context, pod *corev1.Pod, containerName string) (Sample, error) {
+	// we don't need to exec in the kondense container.
+	if isSelf(e.Self, pod, containerName) {
+		output, err := readFiles(DefaultCgroupPath, statsFiles)
+		if err != nil {
+			return Sample{}, err
+		}
+		return newSample(output, time.Now())
+	}
+
+	// head prints a header with the file name before the content of each file.
+	cmd := []string{"head", "-n", "100"}
+	for _, f := range statsFiles {
+		cmd = append(cmd, filepath.Join(DefaultCgroupPath, f))
+	}
+
+	req := e.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: containerName,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.Config, "POST", req.URL())
+	if err != nil {
+		return Sample{}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return Sample{}, err
+	}
+
+	output, err := splitHeadOutput(stdout.Bytes())
+	if err != nil {
+		return Sample{}, fmt.Errorf("error got unexpected stats for container %s: %w", containerName, err)
+	}
+
+	return newSample(output, time.Now())
+}
+
+// splitHeadOutput splits the output of head on multiple files, keyed by file name.
+//
+//	==> /sys/fs/cgroup/memory.pressure <==
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	...
+//
+//	==> /sys/fs/cgroup/cpu.stat <==
+//	usage_usec 2510938
+//	...
+func splitHeadOutput(output []byte) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	var name string
+	for _, line := range strings.SplitAfter(string(output), "\n") {
+		header := strings.TrimSpace(line)
+		if strings.HasPrefix(header, "==> ") && strings.HasSuffix(header, " <==") {
+			name = filepath.Base(strings.TrimSuffix(strings.TrimPrefix(header, "==> "), " <=="))
+			files[name] = []byte{}
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("error content before first file header: %q", line)
+		}
+		files[name] = append(files[name], line...)
+	}
+
+	for _, f := range statsFiles {
+		if _, ok := files[f]; !ok {
+			return nil, fmt.Errorf("error missing file %s", f)
+		}
+	}
+
+	return files, nil
+}
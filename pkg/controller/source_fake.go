@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FakeSource returns samples set by hand. It is meant for tests.
+type FakeSource struct {
+	mu      sync.Mutex
+	samples map[string]Sample
+}
+
+// Set sets the next sample returned for the container. When T is zero, the time of the call to Sample is used.
+func (f *FakeSource) Set(containerName string, sample Sample) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.samples == nil {
+		f.samples = map[string]Sample{}
+	}
+	f.samples[containerName] = sample
+}
+
+func (f *FakeSource) Sample(_ context.Context, pod *corev1.Pod, containerName string) (Sample, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sample, ok := f.samples[containerName]
+	if !ok {
+		return Sample{}, fmt.Errorf("error no fake sample for container %s", containerName)
+	}
+	if sample.T.IsZero() {
+		sample.T = time.Now()
+	}
+
+	return sample, nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubeletSource reads the stats of each container from the kubelet /stats/summary endpoint,
+// through the API server node proxy. It needs the nodes/proxy permission and a kubelet
+// exposing pressure stall information (KubeletPSI feature gate).
+type KubeletSource struct {
+	Client *kubernetes.Clientset
+
+	mu sync.Mutex
+	// summaries are the last summary of each node. All the containers of a node share the same summary during a tick.
+	summaries map[string]*kubeletSummary
+	// fetched is when the summary of each node was fetched.
+	fetched map[string]time.Time
+}
+
+// kubeletSummary is the subset of the kubelet stats summary used by kondense.
+type kubeletSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name string `json:"name"`
+			CPU  *struct {
+				Time                 time.Time   `json:"time"`
+				UsageCoreNanoSeconds *uint64     `json:"usageCoreNanoSeconds"`
+				PSI                  *kubeletPSI `json:"psi"`
+			} `json:"cpu"`
+			Memory *struct {
+				UsageBytes      *uint64     `json:"usageBytes"`
+				WorkingSetBytes *uint64     `json:"workingSetBytes"`
+				PSI             *kubeletPSI `json:"psi"`
+			} `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+type kubeletPSI struct {
+	Some struct {
+		Total uint64 `json:"total"`
+	} `json:"some"`
+}
+
+func (k *KubeletSource) Sample(ctx context.Context, pod *corev1.Pod, containerName string) (Sample, error) {
+	summary, err := k.getSummary(ctx, pod.Spec.NodeName)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	for _, p := range summary.Pods {
+		if p.PodRef.Name != pod.Name || p.PodRef.Namespace != pod.Namespace {
+			continue
+		}
+		for _, c := range p.Containers {
+			if c.Name != containerName {
+				continue
+			}
+			if c.CPU == nil || c.CPU.UsageCoreNanoSeconds == nil {
+				return Sample{}, fmt.Errorf("error kubelet has no cpu stats for container %s", containerName)
+			}
+			if c.Memory == nil || c.Memory.PSI == nil || c.CPU.PSI == nil {
+				return Sample{}, fmt.Errorf("error kubelet has no pressure stats for container %s, is the KubeletPSI feature gate enabled ?", containerName)
+			}
+			var usage, workingSet uint64
+			if c.Memory.UsageBytes != nil {
+				usage = *c.Memory.UsageBytes
+			}
+			if c.Memory.WorkingSetBytes != nil {
+				workingSet = *c.Memory.WorkingSetBytes
+			}
+			return Sample{
+				MemPressure:   cgroup.PSI{Some: cgroup.PSILine{Total: c.Memory.PSI.Some.Total}},
+				MemUsage:      usage,
+				MemWorkingSet: workingSet,
+				CPUPressure:   cgroup.PSI{Some: cgroup.PSILine{Total: c.CPU.PSI.Some.Total}},
+				CPUStat:       cgroup.CPUStat{UsageUsec: *c.CPU.UsageCoreNanoSeconds / 1000},
+				T:             c.CPU.Time,
+			}, nil
+		}
+	}
+
+	return Sample{}, fmt.Errorf("error container %s not found in kubelet stats summary", containerName)
+}
+
+func (k *KubeletSource) getSummary(ctx context.Context, nodeName string) (*kubeletSummary, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if summary, ok := k.summaries[nodeName]; ok && time.Since(k.fetched[nodeName]) < 500*time.Millisecond {
+		return summary, nil
+	}
+
+	b, err := k.Client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &kubeletSummary{}
+	err = json.Unmarshal(b, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.summaries == nil {
+		k.summaries = map[string]*kubeletSummary{}
+		k.fetched = map[string]time.Time{}
+	}
+	k.summaries[nodeName] = summary
+	k.fetched[nodeName] = time.Now()
+
+	return summary, nil
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// state is the content of StateFile.
+type state struct {
+	// PodUID is the pod the stats were collected on. The stats of another pod are not restored.
+	PodUID types.UID `json:"podUID"`
+	// CStats are the stats of every container when the state was saved.
+	CStats ContainerStats `json:"containers"`
+}
+
+// SaveState writes the stats of the containers to StateFile, so they survive a restart of kondense.
+// The file is replaced atomically. Nothing is saved once the reconciler is stopped.
+func (r *Reconciler) SaveState(pod *corev1.Pod) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	if r.StateFile == "" || r.stopped {
+		return nil
+	}
+
+	b, err := json.Marshal(state{PodUID: pod.UID, CStats: r.CStats})
+	if err != nil {
+		return err
+	}
+
+	tmp := r.StateFile + ".tmp"
+	err = os.WriteFile(tmp, b, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.StateFile)
+}
+
+// DeleteState stops the reconciler from saving its state and removes StateFile. A tick in flight doesn't save
+// the state again after it.
+func (r *Reconciler) DeleteState() {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	r.stopped = true
+	if r.StateFile != "" {
+		os.Remove(r.StateFile)
+		os.Remove(r.StateFile + ".tmp")
+	}
+}
+
+// RestoreState reads the stats of the containers saved in StateFile by a previous run of kondense on the same pod.
+// The restored stats are used by InitCStats with the current configuration. The first sample of each container is
+// taken as a baseline, as the cumulative totals kept going up while kondense was not running.
+func (r *Reconciler) RestoreState(pod *corev1.Pod) error {
+	if r.StateFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(r.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	saved := state{}
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		return err
+	}
+	if saved.PodUID != pod.UID {
+		r.logger().Info().Str("state_pod_uid", string(saved.PodUID)).Msg("ignoring state of another pod")
+		return nil
+	}
+
+	r.restored = saved.CStats
+	r.logger().Info().Int("containers", len(saved.CStats)).Msg("restored state")
+
+	return nil
+}
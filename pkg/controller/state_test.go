@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newRestoredReconciler returns a reconciler of the pod restoring its stats from stateFile, like a restarted kondense.
+func newRestoredReconciler(t *testing.T, pod *corev1.Pod, stateFile string) (*Reconciler, *FakeSource) {
+	t.Helper()
+
+	source := &FakeSource{}
+	r := &Reconciler{
+		Client:    fake.NewSimpleClientset(pod.DeepCopy()),
+		Source:    source,
+		LookupEnv: func(string) (string, bool) { return "", false },
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		CStats:    ContainerStats{},
+		StateFile: stateFile,
+	}
+	if err := r.RestoreState(pod); err != nil {
+		t.Fatalf("RestoreState() error = %s", err)
+	}
+	r.InitCStats(pod)
+
+	return r, source
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	container := pod.Spec.Containers[0]
+	start := time.Now()
+
+	r, source := newTestReconciler(t, pod)
+	r.StateFile = stateFile
+	for i, total := range []uint64{1_000, 3_000} {
+		source.Set("app", Sample{
+			MemPressure: cgroup.PSI{Some: cgroup.PSILine{Total: total}},
+			CPUStat:     cgroup.CPUStat{UsageUsec: uint64(i) * 500_000},
+			T:           start.Add(time.Duration(i) * time.Second),
+		})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("UpdateStats() error = %s", err)
+		}
+	}
+	r.CStats["app"].Mem.Floor = 110_000_000
+	if err := r.SaveState(pod); err != nil {
+		t.Fatalf("SaveState() error = %s", err)
+	}
+
+	restored, source := newRestoredReconciler(t, pod, stateFile)
+	s := restored.CStats["app"]
+	if s.Mem.Integral != 2_000 || s.Mem.Floor != 110_000_000 || len(s.Cpu.Probes) != 2 {
+		t.Errorf("restored integral %d, floor %d, %d probes, want 2000, 110000000, 2 probes",
+			s.Mem.Integral, s.Mem.Floor, len(s.Cpu.Probes))
+	}
+	if s.Sampled {
+		t.Fatalf("restored stats are sampled")
+	}
+
+	// the stall while kondense was not running is not counted, the first sample is a baseline.
+	source.Set("app", Sample{
+		MemPressure: cgroup.PSI{Some: cgroup.PSILine{Total: 50_000}},
+		MemEvents:   cgroup.MemoryEvents{OOMKill: 2},
+		T:           start.Add(time.Minute),
+	})
+	if err := restored.UpdateStats(context.Background(), pod, container); err != nil {
+		t.Fatalf("UpdateStats() error = %s", err)
+	}
+	if s.Mem.Integral != 2_000 || s.Mem.PrevTotal != 50_000 {
+		t.Errorf("integral = %d, previous total = %d, want 2000, 50000", s.Mem.Integral, s.Mem.PrevTotal)
+	}
+	if s.Mem.OOMKilled {
+		t.Errorf("out-of-memory kills before the restart recorded again")
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+		wantErr bool
+	}{
+		{name: "missing file", missing: true},
+		{name: "corrupt file", content: `{"podUID": "uid", "containers": {`, wantErr: true},
+		{name: "other pod", content: `{"podUID": "other", "containers": {"app": {}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+			if !tt.missing {
+				if err := os.WriteFile(stateFile, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := &Reconciler{Name: pod.Name, Namespace: pod.Namespace, StateFile: stateFile}
+			err := r.RestoreState(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestoreState() error = %v, want error %t", err, tt.wantErr)
+			}
+			// the stats start from scratch.
+			if r.restored != nil {
+				t.Errorf("restored stats = %v, want none", r.restored)
+			}
+		})
+	}
+}
+
+func TestDeleteState(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	pod.Labels = map[string]string{EnabledKey: "true"}
+	o := &Operator{
+		Client:      fake.NewSimpleClientset(pod.DeepCopy()),
+		StateDir:    t.TempDir(),
+		reconcilers: map[types.UID]*Reconciler{},
+		stopped:     map[types.UID]bool{},
+	}
+
+	o.SetPod(pod)
+	r := o.reconcilers[pod.UID]
+	if err := r.SaveState(pod); err != nil {
+		t.Fatalf("SaveState() error = %s", err)
+	}
+	if _, err := os.Stat(r.StateFile); err != nil {
+		t.Fatalf("state file not saved: %s", err)
+	}
+
+	// the state of a deleted pod is removed, and a tick in flight doesn't save it again.
+	o.DeletePod(pod)
+	if err := r.SaveState(pod); err != nil {
+		t.Fatalf("SaveState() error = %s", err)
+	}
+	if _, err := os.Stat(r.StateFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file of the deleted pod: %v, want not exist", err)
+	}
+}
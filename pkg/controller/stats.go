@@ -1,16 +1,34 @@
 package controller
 
-import "time"
+import (
+	"math"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+)
 
 const (
-	DefaultMemMin            uint64  = 50_000_000
-	DefaultMemMax            uint64  = 100_000_000_000
-	DefaultMemMaxInc         float64 = 0.5
-	DefaultMemMaxDec         float64 = 0.02
-	DefaultMemTargetPressure uint64  = 10_000
-	DefaultMemInterval       uint64  = 10
-	DefaultMemCoeffInc       float64 = 20
-	DefaultMemCoeffDec       float64 = 10
+	DefaultMemMin                 uint64  = 50_000_000
+	DefaultMemMax                 uint64  = 100_000_000_000
+	DefaultMemMaxInc              float64 = 0.5
+	DefaultMemMaxDec              float64 = 0.02
+	DefaultMemTargetPressure      uint64  = 10_000
+	DefaultMemInterval            uint64  = 10
+	DefaultMemCoeffInc            float64 = 20
+	DefaultMemCoeffDec            float64 = 10
+	DefaultMemOOMCooldown         uint64  = 300
+	DefaultMemPolicy                      = MemoryPolicyTMO
+	DefaultMemPIDKp               float64 = 0.1
+	DefaultMemPIDKi               float64 = 0.02
+	DefaultMemPIDKd               float64 = 0
+	DefaultMemPredictive                  = false
+	DefaultMemPredictiveLookahead uint64  = 900
+	DefaultMemPredictiveHeadroom  float64 = 0.1
+	// MemOOMFloorMargin is how much above the out-of-memory killed limit the memory floor is set.
+	MemOOMFloorMargin     float64 = 0.1
+	DefaultMemLimitPolicy         = LimitPolicyRatio
+	DefaultMemLimitRatio  float64 = 2
+	DefaultMemLimitBuffer uint64  = 100_000_000
 )
 
 const (
@@ -21,6 +39,45 @@ const (
 	DefaultCPUTargetAvg float64 = 0.8
 	DefaultCPUInterval  uint64  = 6
 	DefaultCPUCoeff     uint64  = 6
+	// DefaultCPUTargetPressure is in microseconds of cpu stall over the interval.
+	DefaultCPUTargetPressure      uint64  = 100_000
+	DefaultCPUPressureCoeff       float64 = 6
+	DefaultCPUCoeffDec            float64 = 10
+	DefaultCPUPolicy                      = CPUPolicyAvg
+	DefaultCPUTargetThrottleRatio         = 0.1
+	DefaultCPUThrottleCoeff       float64 = 6
+	DefaultCPULimitPolicy                 = LimitPolicyRatio
+	DefaultCPUPercentile          float64 = 0.95
+	DefaultCPUHistoryHalfLife     uint64  = 3600
+	DefaultCPUPredictive                  = false
+	DefaultCPUPredictiveLookahead uint64  = 900
+	DefaultCPULimitRatio          float64 = 2
+	DefaultCPULimitBuffer         uint64  = 500
+)
+
+const (
+	// LimitPolicyRatio sets the limit of a Burstable container to its request times LimitRatio.
+	LimitPolicyRatio = "ratio"
+	// LimitPolicyBuffer sets the limit of a Burstable container to its request plus LimitBuffer.
+	LimitPolicyBuffer = "buffer"
+)
+
+// RequestTolerance is how much the usage of a Burstable container can deviate from its request before the request is resized.
+// e.g. 0.05 means the request is resized when the usage is 5% above or below it.
+const RequestTolerance float64 = 0.05
+
+// Signal is what triggered a resize.
+type Signal string
+
+const (
+	SignalMemPressure   Signal = "memory pressure"
+	SignalOOM           Signal = "out-of-memory kill"
+	SignalWorkingSet    Signal = "memory working set"
+	SignalCPUAvg        Signal = "cpu average"
+	SignalCPUPressure   Signal = "cpu pressure"
+	SignalCPUPercentile Signal = "cpu percentile"
+	SignalPrediction    Signal = "predicted peak"
+	SignalThrottle      Signal = "cpu throttling"
 )
 
 type ContainerStats map[string]*Stats
@@ -30,20 +87,17 @@ type Stats struct {
 	Cpu CPU
 
 	LastUpdate time.Time
+	// Sampled is true when a first sample of the container was taken. It is not saved in the state file,
+	// so the first sample after a restart is a baseline.
+	Sampled bool `json:"-"`
 }
 
-type Memory struct {
-	// Limit is the memory limit in bytes of the container.
-	Limit int64
+// MemoryConfig holds the memory settings of a container.
+type MemoryConfig struct {
 	// Min is the minimum memory limit in bytes allowed on the container.
 	Min uint64
 	// Max is the maximum memory limit in bytes allowed on the container.
 	Max uint64
-	// PrevTotal is the previous total of memory used in bytes on the container.
-	PrevTotal uint64
-	// Integral is the sum of memory used every second.
-	// It is put back to 0 when Interval of time passed or when the memory is patched.
-	Integral uint64
 	// Target presssure is the target memory pressure in microseconds of the container.
 	TargetPressure uint64
 	// MaxInc is the max memory increase in percent allowed. For example 0.5 means kondense can increase the memory limit up to 50%.
@@ -59,13 +113,87 @@ type Memory struct {
 	// Interval is the number of seconds to calculate the target memory pressure.
 	// e.g. when Interval is 7, it means that ideally the target memory pressure should be obtained after 7 seconds.
 	Interval uint64
+	// OOMCooldown is the number of seconds memory decreases are paused after an out-of-memory kill.
+	OOMCooldown uint64
+	// Policy is the name of the memory policy of the container, e.g. MemoryPolicyTMO.
+	Policy string
+	// PIDKp, PIDKi and PIDKd are the proportional, integral and derivative gains of MemoryPolicyPID.
+	PIDKp float64
+	PIDKi float64
+	PIDKd float64
+	// Predictive raises the memory limit before the peaks of working set learned from the daily and weekly seasonality
+	// of the container. The policy corrections apply on top.
+	Predictive bool
+	// PredictiveLookahead is how many seconds before an expected peak the memory limit is raised.
+	PredictiveLookahead uint64
+	// PredictiveHeadroom is the memory kept above the expected working set peak, e.g. 0.1 is 10% above the peak.
+	PredictiveHeadroom float64
+	// LimitPolicy is how the memory limit of a Burstable container follows its request, either LimitPolicyRatio or LimitPolicyBuffer.
+	LimitPolicy string
+	// LimitRatio is the memory limit of a Burstable container divided by its request, used with LimitPolicyRatio. It is bigger than 1.
+	LimitRatio float64
+	// LimitBuffer is the memory in bytes added to the request of a Burstable container to get its limit, used with LimitPolicyBuffer.
+	LimitBuffer uint64
+}
+
+type Memory struct {
+	MemoryConfig
+
+	// Limit is the memory limit in bytes of the container. It is 0 when a Burstable container has no memory limit.
+	Limit int64
+	// Request is the memory request in bytes of the container. It is equal to Limit in Guaranteed pods.
+	Request int64
+	// Usage is the last memory usage in bytes of the container, including the page cache.
+	Usage uint64
+	// WorkingSet is the last memory working set in bytes of the container.
+	WorkingSet uint64
+	// PeakWorkingSet is the highest memory working set in bytes of the container since the memory request was last resized.
+	PeakWorkingSet uint64
+	// PrevTotal is the previous total of memory used in bytes on the container.
+	PrevTotal uint64
+	// Integral is the sum of memory used every second.
+	// It is put back to 0 when Interval of time passed or when the memory is patched.
+	Integral uint64
 	// GraceTicks is the number of seconds passed since Interval went to 0 for the last time.
 	GraceTicks uint64
+
+	// Events are the last memory events of the container.
+	Events cgroup.MemoryEvents
+	// OOMKilled is true when the container was out-of-memory killed and the memory limit was not increased yet.
+	OOMKilled bool
+	// LastOOM is when the container was out-of-memory killed for the last time.
+	LastOOM time.Time
+	// Floor is the minimum memory limit in bytes after an out-of-memory kill. It is above the limit the container was killed at.
+	Floor uint64
+	// Signal is what triggered the last memory factor.
+	Signal Signal
+	// PID is the state of MemoryPolicyPID.
+	PID PIDState
+	// Profile is the daily and weekly seasonality of the working set, learned when the memory is predictive.
+	Profile Profile
+
+	// policy is the memory policy of the container, created from policyName.
+	policy     Policy
+	policyName string
 }
 
-type CPU struct {
-	// Limit is the cpu limit of the container in millicpus.
-	Limit int64
+// PIDState is the state of the pid controller of MemoryPolicyPID.
+type PIDState struct {
+	// Ticks is the number of seconds since the controller was last updated.
+	Ticks uint64
+	// StartTotal is the total of memory stall in microseconds when the interval started.
+	StartTotal uint64
+	// Started is true once the first interval started. It is not saved in the state file, so the stall
+	// while kondense was not running is not taken for the stall of an interval.
+	Started bool `json:"-"`
+	// Integral is the sum of the errors of the past intervals.
+	Integral float64
+	// PrevError is the error of the last interval.
+	PrevError float64
+}
+
+// CPUConfig holds the cpu settings of a container.
+type CPUConfig struct {
 	// Min is the minimum cpu limit allowed on the container in millicpus.
 	Min uint64
 	// Max is the maximum cpu limit allowed on the container in millicpus.
@@ -77,17 +205,97 @@ type CPU struct {
 	// MaxDec is the max cpu decrease in percent allowed. For example 0.5 means kondense can decrease the cpu limit up to 50%.
 	MaxDec float64
 	// Coeff is used to calculate the new cpu limit when a cpu increase is needed. The higher the coeff, the higher the new cpu limit.
+	// It is only used by CPUPolicyAvg.
 	Coeff uint64
 	// Interval is the interval in seconds used to calculate the cpu average usage.
 	Interval uint64
+	// Policy is the name of the cpu policy of the container, e.g. CPUPolicyAvg or CPUPolicyPressure.
+	Policy string
+	// TargetPressure is the target cpu pressure in microseconds of the container, used by CPUPolicyPressure.
+	TargetPressure uint64
+	// PressureCoeff defines how sensitive we are to fluctuations around the target pressure when pressure is higher than target pressure.
+	// e.g. when PressureCoeff is 10, the curve reaches MaxInc when pressure is 10 times the target pressure.
+	// It is only used by CPUPolicyPressure.
+	PressureCoeff float64
+	// CoeffDec defines how sensitive we are to fluctuations around the target pressure when pressure is lower than target pressure.
+	// It is only used by CPUPolicyPressure.
+	CoeffDec float64
+	// TargetThrottleRatio is the target ratio of cpu periods where the container was throttled. It is from 0 to 1.
+	// When the throttle ratio is above the target, the cpu limit is increased even if the average cpu usage is low.
+	TargetThrottleRatio float64
+	// ThrottleCoeff defines how sensitive we are to fluctuations around the target throttle ratio.
+	// e.g. when ThrottleCoeff is 10, the curve reaches MaxInc when the throttle ratio is 10 times the target throttle ratio.
+	ThrottleCoeff float64
+	// Percentile is the percentile of the cpu usage used by CPUPolicyPercentile. It is from 0 to 1. e.g. 0.95 is the P95.
+	Percentile float64
+	// HistoryHalfLife is the number of seconds after which a sample of the cpu usage weights half as much in the
+	// history of CPUPolicyPercentile.
+	HistoryHalfLife uint64
+	// Predictive raises the cpu limit before the peaks of cpu average learned from the daily and weekly seasonality
+	// of the container. The policy corrections apply on top.
+	Predictive bool
+	// PredictiveLookahead is how many seconds before an expected peak the cpu limit is raised.
+	PredictiveLookahead uint64
+	// LimitPolicy is how the cpu limit of a Burstable container follows its request, either LimitPolicyRatio or LimitPolicyBuffer.
+	LimitPolicy string
+	// LimitRatio is the cpu limit of a Burstable container divided by its request, used with LimitPolicyRatio. It is bigger than 1.
+	LimitRatio float64
+	// LimitBuffer is the cpu in millicpus added to the request of a Burstable container to get its limit, used with LimitPolicyBuffer.
+	LimitBuffer uint64
+}
+
+type CPU struct {
+	CPUConfig
+
+	// Limit is the cpu limit of the container in millicpus. It is 0 when a Burstable container has no cpu limit.
+	Limit int64
+	// Request is the cpu request of the container in millicpus. It is equal to Limit in Guaranteed pods.
+	Request int64
 	// Probes is a queue to store total cpu usage at a specific time.
 	Probes []Probe
 	// Avg is the cpu average usage in millicpus.
 	Avg uint64
+
+	// PrevPressureTotal is the previous total of cpu stall in microseconds on the container.
+	PrevPressureTotal uint64
+	// Integral is the sum of cpu stall every second.
+	// It is put back to 0 when the container is patched.
+	Integral uint64
+	// GraceTicks is the number of seconds left before the cpu limit can be decreased by CPUPolicyPressure.
+	GraceTicks uint64
+
+	// ThrottleRatio is the ratio of cpu periods where the container was throttled over Interval.
+	ThrottleRatio float64
+	// ThrottledAvg is the average time the container was throttled over Interval, in microseconds per second.
+	ThrottledAvg uint64
+	// Histogram is the history of the cpu usage of every second, used by CPUPolicyPercentile.
+	Histogram Histogram
+	// Profile is the daily and weekly seasonality of the cpu average, learned when the cpu is predictive.
+	Profile Profile
+	// Signal is what triggered the last cpu factor.
+	Signal Signal
+
+	// policy is the cpu policy of the container, created from policyName.
+	policy     Policy
+	policyName string
 }
 
 // Probe has a total value and a timestamp of when this total was taken.
 type Probe struct {
 	Total uint64
 	T     time.Time
+
+	// NrPeriods, NrThrottled and ThrottledUsec are the cpu throttling totals of cpu.stat.
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUsec uint64
+}
+
+// limit returns the limit of a Burstable container for a request, following policy.
+func limit(request uint64, policy string, ratio float64, buffer uint64) uint64 {
+	if policy == LimitPolicyBuffer {
+		return request + buffer
+	}
+
+	return uint64(math.Ceil(float64(request) * ratio))
 }
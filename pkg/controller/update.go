@@ -1,116 +1,164 @@
 package controller
 
 import (
-	"fmt"
-	"os/exec"
-	"strconv"
-	"strings"
+	"context"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/unagex/kondense/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
 )
 
-func (r *Reconciler) UpdateStats(pod *corev1.Pod, container corev1.Container) error {
+func (r *Reconciler) UpdateStats(ctx context.Context, pod *corev1.Pod, container corev1.Container) error {
+	start := time.Now()
+
 	var err error
-	var output []byte
+	var sample Sample
 	for i := 0; i < 3; i++ {
-		cmd := exec.Command("kubectl", "exec", "-i", r.Name, "-c", container.Name, "--", "cat", "/sys/fs/cgroup/memory.pressure", "/sys/fs/cgroup/cpu.stat")
-		// we don't need kubectl for kondense container.
-		if strings.ToLower(container.Name) == "kondense" {
-			cmd = exec.Command("cat", "/sys/fs/cgroup/memory.pressure", "/sys/fs/cgroup/cpu.stat")
-		}
-		output, err = cmd.Output()
-		if err == nil {
-			r.CStats[container.Name].LastUpdate = time.Now()
+		sample, err = r.sample(ctx, pod, container.Name)
+		if err == nil || ctx.Err() != nil {
 			break
 		}
 		time.Sleep(50 * time.Millisecond)
 	}
+	metrics.StatsDuration.WithLabelValues(r.Namespace, r.Name, container.Name).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.StatsErrors.WithLabelValues(r.Namespace, r.Name, container.Name).Inc()
 		return err
 	}
 
-	txt := strings.Split(string(output), " ")
-	if len(txt) != 15 {
-		return fmt.Errorf("error got unexpected stats for container %s: %s", container.Name, txt)
+	s := r.CStats[container.Name]
+	// the kubelet refreshes its stats less often than kondense samples them, the same sample would be counted twice.
+	if s.Sampled && !sample.T.After(s.LastUpdate) {
+		r.logger().Debug().Str("container", container.Name).Time("sample_time", sample.T).Msg("skipped stale sample")
+		return nil
 	}
+	s.LastUpdate = sample.T
 
-	err = r.UpdateMemStats(container.Name, txt)
-	if err != nil {
-		return err
-	}
+	r.UpdateMemStats(container.Name, sample)
+	r.UpdateCPUStats(container.Name, sample)
 
-	err = r.UpdateCPUStats(container.Name, txt)
-	if err != nil {
-		return err
+	if s.Mem.Predictive {
+		s.Mem.Profile.Add(float64(s.Mem.WorkingSet), sample.T)
 	}
-
-	s := r.CStats[container.Name]
-	log.Info().
+	if s.Cpu.Predictive && len(s.Cpu.Probes) > 1 {
+		s.Cpu.Profile.Add(float64(s.Cpu.Avg), sample.T)
+	}
+	s.Sampled = true
+
+	metrics.MemoryLimit.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Mem.Limit))
+	metrics.MemoryRequest.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Mem.Request))
+	metrics.MemoryWorkingSet.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Mem.WorkingSet))
+	metrics.MemoryIntegral.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Mem.Integral))
+	metrics.CPULimit.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Cpu.Limit))
+	metrics.CPURequest.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Cpu.Request))
+	metrics.CPUAverage.WithLabelValues(r.Namespace, r.Name, container.Name).Set(float64(s.Cpu.Avg))
+	r.logger().Info().
 		Str("container", container.Name).
 		Int64("memory_limit", s.Mem.Limit).
+		Int64("memory_request", s.Mem.Request).
+		Uint64("memory_working_set", s.Mem.WorkingSet).
 		Uint64("memory_time to decrease", s.Mem.GraceTicks).
 		Uint64("memory_total", s.Mem.PrevTotal).
 		Uint64("integral", s.Mem.Integral).
+		Uint64("memory_high_events", s.Mem.Events.High).
+		Uint64("memory_max_events", s.Mem.Events.Max).
+		Uint64("memory_oom_kill_events", s.Mem.Events.OOMKill).
+		Uint64("memory_floor", s.Mem.Floor).
 		Int64("cpu_limit", s.Cpu.Limit).
+		Int64("cpu_request", s.Cpu.Request).
 		Uint64("cpu_average", s.Cpu.Avg).
+		Uint64("cpu_integral", s.Cpu.Integral).
+		Float64("cpu_throttle_ratio", s.Cpu.ThrottleRatio).
+		Uint64("cpu_throttled_average", s.Cpu.ThrottledAvg).
 		Msg("updated stats")
 
 	return nil
 }
 
-func (r *Reconciler) UpdateMemStats(containerName string, txt []string) error {
+// sample gets a sample of the stats of the container, abandoned after SampleTimeout so a slow container
+// doesn't hold the tick of the whole pod.
+func (r *Reconciler) sample(ctx context.Context, pod *corev1.Pod, containerName string) (Sample, error) {
+	ctx, cancel := context.WithTimeout(ctx, SampleTimeout)
+	defer cancel()
+
+	return r.Source.Sample(ctx, pod, containerName)
+}
+
+func (r *Reconciler) UpdateMemStats(containerName string, sample Sample) {
 	s := r.CStats[containerName]
 
-	totalTmp := strings.TrimPrefix(txt[4], "total=")
-	totalTmp = strings.TrimSuffix(totalTmp, "\nfull")
-	total, err := strconv.ParseUint(totalTmp, 10, 64)
-	if err != nil {
-		return err
+	// the first sample is a baseline, and counters are reset when the container restarts.
+	if s.Sampled && sample.MemPressure.Some.Total >= s.Mem.PrevTotal {
+		s.Mem.Integral += sample.MemPressure.Some.Total - s.Mem.PrevTotal
 	}
+	s.Mem.PrevTotal = sample.MemPressure.Some.Total
 
-	delta := total - s.Mem.PrevTotal
-	s.Mem.PrevTotal = total
-	s.Mem.Integral += delta
+	s.Mem.Usage = sample.MemUsage
+	s.Mem.WorkingSet = sample.MemWorkingSet
+	s.Mem.PeakWorkingSet = max(s.Mem.PeakWorkingSet, sample.MemWorkingSet)
 
-	return nil
+	// counters are reset when the container restarts.
+	events := sample.MemEvents
+	if s.Sampled && events.OOMKill+events.OOMGroupKill > s.Mem.Events.OOMKill+s.Mem.Events.OOMGroupKill {
+		r.RecordOOM(containerName, sample.T)
+	}
+	s.Mem.Events = events
 }
 
-func (r *Reconciler) UpdateCPUStats(containerName string, txt []string) error {
+func (r *Reconciler) UpdateCPUStats(containerName string, sample Sample) {
 	s := r.CStats[containerName]
 
-	totalTmp := strings.TrimSuffix(txt[9], "\nuser_usec")
-	total, err := strconv.ParseUint(totalTmp, 10, 64)
-	if err != nil {
-		return err
+	// the first sample is a baseline, and counters are reset when the container restarts.
+	if s.Sampled && sample.CPUPressure.Some.Total >= s.Cpu.PrevPressureTotal {
+		s.Cpu.Integral += sample.CPUPressure.Some.Total - s.Cpu.PrevPressureTotal
+	}
+	s.Cpu.PrevPressureTotal = sample.CPUPressure.Some.Total
+
+	if n := len(s.Cpu.Probes); n > 0 && sample.CPUStat.UsageUsec < s.Cpu.Probes[n-1].Total {
+		// the container restarted, the probes are from its previous run.
+		s.Cpu.Probes = s.Cpu.Probes[:0]
 	}
 
-	if len(s.Cpu.Probes) == int(s.Cpu.Interval) {
+	if len(s.Cpu.Probes) > 0 && len(s.Cpu.Probes) >= int(s.Cpu.Interval) {
 		// Pop oldest probe if Probes is full
 		s.Cpu.Probes = s.Cpu.Probes[1:]
 	}
 
 	p := Probe{
-		Total: total,
-		T:     s.LastUpdate,
+		Total: sample.CPUStat.UsageUsec,
+		T:     sample.T,
+
+		NrPeriods:     sample.CPUStat.NrPeriods,
+		NrThrottled:   sample.CPUStat.NrThrottled,
+		ThrottledUsec: sample.CPUStat.ThrottledUsec,
 	}
 	s.Cpu.Probes = append(s.Cpu.Probes, p)
 
 	// We can calculate when we have 2 or more probes
 	if len(s.Cpu.Probes) == 1 {
-		return nil
+		return
 	}
 
 	oldestProbe := s.Cpu.Probes[0]
 	newestProbe := s.Cpu.Probes[len(s.Cpu.Probes)-1]
 
-	delta := newestProbe.Total - oldestProbe.Total
+	if s.Cpu.Policy == CPUPolicyPercentile {
+		prevProbe := s.Cpu.Probes[len(s.Cpu.Probes)-2]
+		usage := float64(newestProbe.Total-prevProbe.Total) / max(1, float64(newestProbe.T.Sub(prevProbe.T).Microseconds()))
+		s.Cpu.Histogram.Add(uint64(usage*1000), newestProbe.T, time.Duration(s.Cpu.HistoryHalfLife)*time.Second)
+	}
+
+	usage := newestProbe.Total - oldestProbe.Total
 	t := newestProbe.T.Sub(oldestProbe.T)
 
-	avgCPU := float64(delta) / max(1, float64(t.Microseconds()))
+	avgCPU := float64(usage) / max(1, float64(t.Microseconds()))
 	avgMCPU := uint64(avgCPU * 1000)
 	s.Cpu.Avg = avgMCPU
 
-	return nil
+	periods := newestProbe.NrPeriods - oldestProbe.NrPeriods
+	throttled := newestProbe.NrThrottled - oldestProbe.NrThrottled
+	s.Cpu.ThrottleRatio = float64(throttled) / float64(max(1, periods))
+
+	throttledUsec := newestProbe.ThrottledUsec - oldestProbe.ThrottledUsec
+	s.Cpu.ThrottledAvg = uint64(float64(throttledUsec) / max(1, t.Seconds()))
 }
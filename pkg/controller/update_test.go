@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unagex/kondense/pkg/cgroup"
+)
+
+func TestUpdateStatsMemoryPressure(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, source := newTestReconciler(t, pod)
+	container := pod.Spec.Containers[0]
+	start := time.Now()
+
+	tests := []struct {
+		name         string
+		total        uint64
+		wantIntegral uint64
+	}{
+		// the pressure accumulated before the first sample is not counted.
+		{name: "baseline", total: 5_000, wantIntegral: 0},
+		{name: "pressure", total: 7_000, wantIntegral: 2_000},
+		{name: "restarted container", total: 1_000, wantIntegral: 2_000},
+		{name: "pressure after restart", total: 1_500, wantIntegral: 2_500},
+	}
+
+	for i, tt := range tests {
+		source.Set("app", Sample{
+			MemPressure: cgroup.PSI{Some: cgroup.PSILine{Total: tt.total}},
+			T:           start.Add(time.Duration(i) * time.Second),
+		})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("%s: UpdateStats() error = %s", tt.name, err)
+		}
+
+		s := r.CStats["app"]
+		if s.Mem.Integral != tt.wantIntegral {
+			t.Errorf("%s: integral = %d, want %d", tt.name, s.Mem.Integral, tt.wantIntegral)
+		}
+		if s.Mem.PrevTotal != tt.total {
+			t.Errorf("%s: previous total = %d, want %d", tt.name, s.Mem.PrevTotal, tt.total)
+		}
+	}
+}
+
+func TestUpdateStatsCPU(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name       string
+		interval   uint64
+		usages     []uint64
+		wantProbes int
+		wantAvg    uint64
+	}{
+		{name: "average", interval: 6, usages: []uint64{0, 500_000, 1_000_000}, wantProbes: 3, wantAvg: 500},
+		{name: "full probes", interval: 2, usages: []uint64{0, 100_000, 1_100_000}, wantProbes: 2, wantAvg: 1000},
+		// the probes of the previous run of the container are dropped.
+		{name: "restarted container", interval: 6, usages: []uint64{5_000_000, 6_000_000, 100_000, 300_000}, wantProbes: 2, wantAvg: 200},
+		// an interval of 0 is a configuration error, the stats must still not panic.
+		{name: "interval 0", interval: 0, usages: []uint64{0, 100_000, 200_000}, wantProbes: 1, wantAvg: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+			r, source := newTestReconciler(t, pod)
+			r.CStats["app"].Cpu.Interval = tt.interval
+
+			for i, usage := range tt.usages {
+				source.Set("app", Sample{
+					CPUStat: cgroup.CPUStat{UsageUsec: usage},
+					T:       start.Add(time.Duration(i) * time.Second),
+				})
+				if err := r.UpdateStats(context.Background(), pod, pod.Spec.Containers[0]); err != nil {
+					t.Fatalf("UpdateStats() error = %s", err)
+				}
+			}
+
+			s := r.CStats["app"]
+			if len(s.Cpu.Probes) != tt.wantProbes {
+				t.Errorf("probes = %d, want %d", len(s.Cpu.Probes), tt.wantProbes)
+			}
+			if s.Cpu.Avg != tt.wantAvg {
+				t.Errorf("average = %dm, want %dm", s.Cpu.Avg, tt.wantAvg)
+			}
+		})
+	}
+}
+
+func TestUpdateStatsStaleSample(t *testing.T) {
+	pod := testPod(resources(100_000_000, 500), resources(100_000_000, 500))
+	r, source := newTestReconciler(t, pod)
+	r.CStats["app"].Cpu.Interval = 6
+	container := pod.Spec.Containers[0]
+	start := time.Now()
+
+	samples := []struct {
+		t     time.Time
+		total uint64
+		usage uint64
+	}{
+		{t: start, total: 1_000, usage: 0},
+		{t: start.Add(time.Second), total: 3_000, usage: 500_000},
+		// the kubelet returns the same sample until it refreshes its stats.
+		{t: start.Add(time.Second), total: 3_000, usage: 500_000},
+		// a sample older than the last one is skipped too.
+		{t: start, total: 1_000, usage: 0},
+		{t: start.Add(2 * time.Second), total: 4_000, usage: 1_000_000},
+	}
+
+	for _, sample := range samples {
+		source.Set("app", Sample{
+			MemPressure: cgroup.PSI{Some: cgroup.PSILine{Total: sample.total}},
+			CPUStat:     cgroup.CPUStat{UsageUsec: sample.usage},
+			T:           sample.t,
+		})
+		if err := r.UpdateStats(context.Background(), pod, container); err != nil {
+			t.Fatalf("UpdateStats() error = %s", err)
+		}
+	}
+
+	s := r.CStats["app"]
+	if s.Mem.Integral != 3_000 {
+		t.Errorf("integral = %d, want %d", s.Mem.Integral, 3_000)
+	}
+	if len(s.Cpu.Probes) != 3 {
+		t.Errorf("probes = %d, want %d", len(s.Cpu.Probes), 3)
+	}
+	if s.Cpu.Avg != 500 {
+		t.Errorf("average = %dm, want %dm", s.Cpu.Avg, 500)
+	}
+	if !s.LastUpdate.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("last update = %s, want %s", s.LastUpdate, start.Add(2*time.Second))
+	}
+}
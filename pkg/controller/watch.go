@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchPod starts an informer on the pod of the reconciler and waits for its cache to sync.
+// The latest pod is kept in memory, so the API server is only called when the pod changes.
+func (r *Reconciler) WatchPod(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(r.Client, 0,
+		informers.WithNamespace(r.Namespace),
+		informers.WithTweakListOptions(func(opts *v1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", r.Name).String()
+		}),
+	)
+
+	informer := factory.Core().V1().Pods().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			r.SetPod(obj.(*corev1.Pod))
+		},
+		UpdateFunc: func(_, obj any) {
+			r.SetPod(obj.(*corev1.Pod))
+		},
+		DeleteFunc: func(_ any) {
+			r.SetPod(nil)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("error failed to sync informer for %v", typ)
+		}
+	}
+
+	log.Info().Str("pod", r.Name).Msg("watching pod")
+
+	return nil
+}
+
+// SetPod sets the latest version of the pod.
+func (r *Reconciler) SetPod(pod *corev1.Pod) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	r.pod = pod
+	r.podChanged = true
+}
+
+// Pod returns the latest version of the pod, and true when it changed since the last call.
+func (r *Reconciler) Pod() (*corev1.Pod, bool) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	changed := r.podChanged
+	r.podChanged = false
+
+	return r.pod, changed
+}
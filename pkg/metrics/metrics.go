@@ -0,0 +1,111 @@
+// Package metrics exposes the decisions of kondense as prometheus metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kondense"
+
+// labels of every per container metric.
+var labels = []string{"namespace", "pod", "container"}
+
+var (
+	MemoryLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_limit_bytes",
+		Help:      "Memory limit of the container in bytes.",
+	}, labels)
+	MemoryRequest = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_request_bytes",
+		Help:      "Memory request of the container in bytes.",
+	}, labels)
+	MemoryWorkingSet = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_working_set_bytes",
+		Help:      "Memory working set of the container in bytes.",
+	}, labels)
+	MemoryIntegral = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_pressure_integral_microseconds",
+		Help:      "Memory stall time of the container since the last patch in microseconds.",
+	}, labels)
+	MemoryFactor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_factor",
+		Help:      "Last memory factor computed for the container. e.g. 0.5 is a 50% increase.",
+	}, labels)
+
+	CPULimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_limit_millicores",
+		Help:      "CPU limit of the container in millicpus.",
+	}, labels)
+	CPURequest = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_request_millicores",
+		Help:      "CPU request of the container in millicpus.",
+	}, labels)
+	CPUAverage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_average_millicores",
+		Help:      "CPU average usage of the container over its interval in millicpus.",
+	}, labels)
+	CPUFactor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_factor",
+		Help:      "Last cpu factor computed for the container. e.g. 0.5 is a 50% increase.",
+	}, labels)
+
+	Patches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patches_total",
+		Help:      "Number of successful resources patches of the container.",
+	}, labels)
+	PatchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patch_failures_total",
+		Help:      "Number of failed resources patches of the container.",
+	}, labels)
+
+	StatsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stats_collection_duration_seconds",
+		Help:      "Time to collect the stats of the container in seconds.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, labels)
+	StatsErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stats_errors_total",
+		Help:      "Number of failed stats collections of the container.",
+	}, labels)
+)
+
+func init() {
+	prometheus.MustRegister(
+		MemoryLimit,
+		MemoryRequest,
+		MemoryWorkingSet,
+		MemoryIntegral,
+		MemoryFactor,
+		CPULimit,
+		CPURequest,
+		CPUAverage,
+		CPUFactor,
+		Patches,
+		PatchFailures,
+		StatsDuration,
+		StatsErrors,
+	)
+}
+
+// DeletePod deletes the metrics of every container of a pod, e.g. when the pod is deleted.
+func DeletePod(podNamespace, podName string) {
+	l := prometheus.Labels{"namespace": podNamespace, "pod": podName}
+	for _, vec := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{MemoryLimit, MemoryRequest, MemoryWorkingSet, MemoryIntegral, MemoryFactor, CPULimit, CPURequest, CPUAverage, CPUFactor, Patches, PatchFailures, StatsDuration, StatsErrors} {
+		vec.DeletePartialMatch(l)
+	}
+}
@@ -1,14 +1,15 @@
 package utils
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"net/http"
 	"os"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 func ContainersToExclude() []string {
@@ -21,11 +22,11 @@ func ContainersToExclude() []string {
 	return exclude
 }
 
-func GetClient() (*kubernetes.Clientset, error) {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, err
-	}
+func GetConfig() (*rest.Config, error) {
+	return rest.InClusterConfig()
+}
+
+func GetClient(config *rest.Config) (*kubernetes.Clientset, error) {
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
@@ -34,28 +35,9 @@ func GetClient() (*kubernetes.Clientset, error) {
 	return client, nil
 }
 
-func GetRawClient() (*http.Client, error) {
-	caCert, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/ca.crt")
-	if err != nil {
-		return nil, err
-	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
-
-	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: caCertPool,
-			},
-		},
-	}, nil
-}
-
-func GetBearerToken() (string, error) {
-	token, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
-	if err != nil {
-		return "", err
-	}
+func GetRecorder(client *kubernetes.Clientset) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
 
-	return "Bearer " + string(token), nil
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kondense"})
 }
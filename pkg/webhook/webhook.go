@@ -0,0 +1,319 @@
+// Package webhook injects the kondense sidecar into pods with a mutating admission webhook.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/unagex/kondense/pkg/controller"
+)
+
+// ContainerName is the name of the injected sidecar.
+const ContainerName = controller.ContainerName
+
+// DefaultImage is the image of the injected sidecar.
+const DefaultImage = "kondense/kondense:1.1.0"
+
+// Injector injects the kondense sidecar into the pods with the label kondense.unagex.com/enabled=true.
+type Injector struct {
+	// Image is the image of the sidecar. It defaults to DefaultImage.
+	Image string
+	// NativeSidecar injects the sidecar as an init container with a restart policy of Always, so it
+	// doesn't keep Jobs running and it starts before and stops after the containers of the pod.
+	NativeSidecar bool
+}
+
+// ServeHTTP answers an AdmissionReview of a pod with a patch injecting the sidecar.
+func (i *Injector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := admissionv1.AdmissionReview{}
+	err = json.Unmarshal(body, &review)
+	if err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("error cannot decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review.Response = i.Review(review.Request)
+	review.Request = nil
+
+	b, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Review returns the response to an admission request of a pod. The pod is always allowed,
+// with a patch when the sidecar was injected.
+func (i *Injector) Review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	pod := &corev1.Pod{}
+	err := json.Unmarshal(req.Object.Raw, pod)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to decode pod")
+		resp.Warnings = []string{fmt.Sprintf("kondense: cannot decode pod: %s", err)}
+		return resp
+	}
+
+	orig := pod.DeepCopy()
+	if !i.Inject(pod) {
+		return resp
+	}
+	resp.Warnings = Warnings(pod)
+
+	patch, err := json.Marshal(patchOps(orig, pod))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal patch")
+		return resp
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	resp.Patch = patch
+	resp.PatchType = &patchType
+
+	log.Info().
+		Str("namespace", req.Namespace).
+		Str("pod", pod.Name+pod.GenerateName).
+		Msg("injected kondense sidecar")
+
+	return resp
+}
+
+// Inject adds the kondense sidecar to the pod when it has the label kondense.unagex.com/enabled=true
+// and no sidecar yet. It copies the requests of the containers and of the init containers to their limits,
+// so the pod has a QoS class of Guaranteed, and sets the resize policy of the containers and of the native
+// sidecars so they are resized without restart. It returns true when the pod was changed.
+func (i *Injector) Inject(pod *corev1.Pod) bool {
+	if pod.Labels[controller.EnabledKey] != "true" {
+		return false
+	}
+	isSidecar := func(c corev1.Container) bool { return c.Name == ContainerName }
+	if slices.ContainsFunc(pod.Spec.Containers, isSidecar) || slices.ContainsFunc(pod.Spec.InitContainers, isSidecar) {
+		return false
+	}
+
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		guarantee(c)
+		resizePolicy(c)
+	}
+	// the init containers count in the QoS class of the pod, only the native sidecars can be resized.
+	for idx := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[idx]
+		guarantee(c)
+		if controller.IsSidecar(*c) {
+			resizePolicy(c)
+		}
+	}
+
+	pod.Spec.ShareProcessNamespace = ptr(true)
+	sidecar := i.sidecar(pod)
+	if i.NativeSidecar {
+		sidecar.RestartPolicy = ptr(corev1.ContainerRestartPolicyAlways)
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, sidecar)
+	} else {
+		pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
+	}
+
+	return true
+}
+
+// patchOp is an operation of a JSON patch.
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// patchOps returns the JSON patch turning the pod orig into the injected pod. Only the fields set by Inject are
+// added, so the fields of the pod unknown to the API version kondense is built with are kept.
+func patchOps(orig, pod *corev1.Pod) []patchOp {
+	ops := []patchOp{}
+
+	for idx := range orig.Spec.Containers {
+		path := fmt.Sprintf("/spec/containers/%d", idx)
+		ops = append(ops, containerOps(path, orig.Spec.Containers[idx], pod.Spec.Containers[idx])...)
+	}
+	for idx := range orig.Spec.InitContainers {
+		path := fmt.Sprintf("/spec/initContainers/%d", idx)
+		ops = append(ops, containerOps(path, orig.Spec.InitContainers[idx], pod.Spec.InitContainers[idx])...)
+	}
+
+	ops = append(ops, patchOp{Op: "add", Path: "/spec/shareProcessNamespace", Value: true})
+
+	if len(pod.Spec.InitContainers) > len(orig.Spec.InitContainers) {
+		sidecar := pod.Spec.InitContainers[len(pod.Spec.InitContainers)-1]
+		if orig.Spec.InitContainers == nil {
+			ops = append(ops, patchOp{Op: "add", Path: "/spec/initContainers", Value: []corev1.Container{sidecar}})
+		} else {
+			ops = append(ops, patchOp{Op: "add", Path: "/spec/initContainers/-", Value: sidecar})
+		}
+	} else {
+		sidecar := pod.Spec.Containers[len(pod.Spec.Containers)-1]
+		ops = append(ops, patchOp{Op: "add", Path: "/spec/containers/-", Value: sidecar})
+	}
+
+	return ops
+}
+
+// containerOps returns the JSON patch operations turning the container o at path into the injected container c:
+// its limits and its resize policy.
+func containerOps(path string, o, c corev1.Container) []patchOp {
+	ops := []patchOp{}
+
+	if o.Resources.Limits == nil && c.Resources.Limits != nil {
+		ops = append(ops, patchOp{Op: "add", Path: path + "/resources/limits", Value: c.Resources.Limits})
+	} else {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			limit, ok := c.Resources.Limits[name]
+			if origLimit, origOk := o.Resources.Limits[name]; !ok || (origOk && origLimit.Equal(limit)) {
+				continue
+			}
+			// add replaces the limit when there is one.
+			ops = append(ops, patchOp{Op: "add", Path: path + "/resources/limits/" + string(name), Value: limit})
+		}
+	}
+
+	if o.ResizePolicy == nil && c.ResizePolicy != nil {
+		ops = append(ops, patchOp{Op: "add", Path: path + "/resizePolicy", Value: c.ResizePolicy})
+	} else {
+		for _, p := range c.ResizePolicy[len(o.ResizePolicy):] {
+			ops = append(ops, patchOp{Op: "add", Path: path + "/resizePolicy/-", Value: p})
+		}
+	}
+
+	return ops
+}
+
+// Warnings returns why the pod won't have a QoS class of Guaranteed after the injection.
+func Warnings(pod *corev1.Pod) []string {
+	warnings := []string{}
+	for _, c := range pod.Spec.Containers {
+		warnings = append(warnings, limitWarnings("container", c)...)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		warnings = append(warnings, limitWarnings("init container", c)...)
+	}
+
+	return warnings
+}
+
+// limitWarnings returns the cpu and memory limits missing on the container, which is of kind container or init container.
+func limitWarnings(kind string, c corev1.Container) []string {
+	warnings := []string{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if _, ok := c.Resources.Limits[name]; !ok {
+			warnings = append(warnings, fmt.Sprintf(
+				"kondense: %s %s has no %s request or limit, the pod won't have a QoS class of Guaranteed", kind, c.Name, name))
+		}
+	}
+
+	return warnings
+}
+
+// guarantee copies the cpu and memory requests of the container to its limits.
+func guarantee(c *corev1.Container) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		request, ok := c.Resources.Requests[name]
+		if !ok {
+			// the API server defaults requests to limits.
+			continue
+		}
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		c.Resources.Limits[name] = request
+	}
+}
+
+// resizePolicy sets the cpu and memory of the container to be resized without restart, unless they have a policy.
+func resizePolicy(c *corev1.Container) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if slices.ContainsFunc(c.ResizePolicy, func(p corev1.ContainerResizePolicy) bool { return p.ResourceName == name }) {
+			continue
+		}
+		c.ResizePolicy = append(c.ResizePolicy, corev1.ContainerResizePolicy{
+			ResourceName:  name,
+			RestartPolicy: corev1.NotRequired,
+		})
+	}
+}
+
+// sidecar returns the kondense container of the pod. The global settings of kondense can be set with pod
+// annotations, e.g. kondense.unagex.com/exclude is the EXCLUDE environment variable of the sidecar.
+// The annotations of the containers settings are read by the sidecar directly.
+func (i *Injector) sidecar(pod *corev1.Pod) corev1.Container {
+	image := i.Image
+	if image == "" {
+		image = DefaultImage
+	}
+
+	env := []corev1.EnvVar{}
+	for k, v := range pod.Annotations {
+		setting, ok := strings.CutPrefix(k, controller.AnnotationPrefix)
+		if !ok || setting == "enabled" || strings.Contains(setting, ".") {
+			continue
+		}
+		env = append(env, corev1.EnvVar{
+			Name:  strings.ToUpper(strings.ReplaceAll(setting, "-", "_")),
+			Value: v,
+		})
+	}
+	slices.SortFunc(env, func(a, b corev1.EnvVar) int { return strings.Compare(a.Name, b.Name) })
+
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("80m"),
+		corev1.ResourceMemory: resource.MustParse("50M"),
+	}
+
+	return corev1.Container{
+		Name:  ContainerName,
+		Image: image,
+		Env:   env,
+		Resources: corev1.ResourceRequirements{
+			Requests: resources,
+			Limits:   resources,
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add: []corev1.Capability{"SYS_PTRACE"},
+			},
+		},
+		LivenessProbe:  probe("/healthz"),
+		ReadinessProbe: probe("/readyz"),
+	}
+}
+
+func probe(path string) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromInt32(controller.HealthPort),
+			},
+		},
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/unagex/kondense/pkg/controller"
+)
+
+// container returns a container with these cpu and memory requests, and limits when limits is true.
+func container(name, cpu, memory string, limits bool) corev1.Container {
+	c := corev1.Container{Name: name, Image: name}
+	if cpu == "" {
+		return c
+	}
+
+	list := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+	c.Resources.Requests = list
+	if limits {
+		c.Resources.Limits = list.DeepCopy()
+	}
+
+	return c
+}
+
+// review returns the response of the injector to the creation of the pod, and the pod patched with it.
+func review(t *testing.T, i *Injector, pod *corev1.Pod) (*admissionv1.AdmissionResponse, *corev1.Pod) {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := i.Review(&admissionv1.AdmissionRequest{UID: "uid", Object: runtime.RawExtension{Raw: raw}})
+	if !resp.Allowed {
+		t.Fatalf("pod not allowed")
+	}
+	if resp.Patch == nil {
+		return resp, nil
+	}
+
+	patch, err := jsonpatch.DecodePatch(resp.Patch)
+	if err != nil {
+		t.Fatalf("cannot decode patch: %s", err)
+	}
+	b, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatalf("cannot apply patch: %s", err)
+	}
+	patched := &corev1.Pod{}
+	if err := json.Unmarshal(b, patched); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, patched
+}
+
+func TestReview(t *testing.T) {
+	enabled := map[string]string{controller.EnabledKey: "true"}
+	notRequired := []corev1.ContainerResizePolicy{
+		{ResourceName: corev1.ResourceCPU, RestartPolicy: corev1.NotRequired},
+		{ResourceName: corev1.ResourceMemory, RestartPolicy: corev1.NotRequired},
+	}
+	always := corev1.ContainerRestartPolicyAlways
+
+	tests := []struct {
+		name          string
+		native        bool
+		labels        map[string]string
+		annotations   map[string]string
+		containers    []corev1.Container
+		init          []corev1.Container
+		wantInjected  bool
+		wantWarnings  []string
+		wantEnv       []corev1.EnvVar
+		wantInitNames []string
+	}{
+		{name: "unlabelled pod", containers: []corev1.Container{container("app", "100m", "100M", false)}},
+		{name: "sidecar already injected", labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true), container(ContainerName, "80m", "50M", true)}},
+		{name: "native sidecar already injected", labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true)}, init: []corev1.Container{container(ContainerName, "80m", "50M", true)}},
+		{name: "container", labels: enabled, containers: []corev1.Container{container("app", "100m", "100M", false)}, wantInjected: true},
+		{name: "native sidecar", native: true, labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true)}, wantInjected: true, wantInitNames: []string{ContainerName}},
+		{name: "native sidecar after init containers", native: true, labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true)},
+			init:       []corev1.Container{container("migrate", "200m", "200M", false)},
+			wantInjected: true, wantInitNames: []string{"migrate", ContainerName}},
+		{name: "container with init containers", labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true)},
+			init:       []corev1.Container{container("migrate", "200m", "200M", false)},
+			wantInjected: true, wantInitNames: []string{"migrate"}},
+		// a Burstable init container makes the pod Burstable.
+		{name: "init container without resources", labels: enabled,
+			containers: []corev1.Container{container("app", "100m", "100M", true)},
+			init:       []corev1.Container{container("migrate", "", "", false)},
+			wantInjected: true, wantInitNames: []string{"migrate"},
+			wantWarnings: []string{"init container migrate has no cpu", "init container migrate has no memory"}},
+		{name: "container without resources", labels: enabled, containers: []corev1.Container{container("app", "", "", false)},
+			wantInjected: true, wantWarnings: []string{"container app has no cpu", "container app has no memory"}},
+		// the global annotations are environment variables of the sidecar, the container settings are read by the sidecar.
+		{name: "annotations", labels: enabled, annotations: map[string]string{
+			controller.AnnotationPrefix + "exclude":        "db",
+			controller.AnnotationPrefix + "stats-source":   "exec",
+			controller.AnnotationPrefix + "app.memory-min": "50M",
+			controller.EnabledKey:                          "true",
+		}, containers: []corev1.Container{container("app", "100m", "100M", true)}, wantInjected: true,
+			wantEnv: []corev1.EnvVar{{Name: "EXCLUDE", Value: "db"}, {Name: "STATS_SOURCE", Value: "exec"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: tt.labels, Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: tt.containers, InitContainers: tt.init},
+			}
+			i := &Injector{NativeSidecar: tt.native}
+
+			resp, patched := review(t, i, pod)
+			if (patched != nil) != tt.wantInjected {
+				t.Fatalf("injected = %t, want %t", patched != nil, tt.wantInjected)
+			}
+			if !tt.wantInjected {
+				return
+			}
+
+			// the patch gives the pod injected by Inject.
+			want := pod.DeepCopy()
+			i.Inject(want)
+			if !equality.Semantic.DeepEqual(patched.Spec, want.Spec) {
+				t.Errorf("patched spec = %+v, want %+v", patched.Spec, want.Spec)
+			}
+
+			var sidecar corev1.Container
+			var initNames []string
+			for _, c := range patched.Spec.InitContainers {
+				initNames = append(initNames, c.Name)
+				if c.Name == ContainerName {
+					sidecar = c
+				}
+			}
+			if strings.Join(initNames, ",") != strings.Join(tt.wantInitNames, ",") {
+				t.Errorf("init containers = %v, want %v", initNames, tt.wantInitNames)
+			}
+			if tt.native {
+				if sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != always {
+					t.Errorf("sidecar restart policy = %v, want %s", sidecar.RestartPolicy, always)
+				}
+			} else {
+				sidecar = patched.Spec.Containers[len(patched.Spec.Containers)-1]
+				if sidecar.Name != ContainerName {
+					t.Fatalf("last container = %s, want %s", sidecar.Name, ContainerName)
+				}
+			}
+			if len(sidecar.Env) != len(tt.wantEnv) || (len(tt.wantEnv) > 0 && !equality.Semantic.DeepEqual(sidecar.Env, tt.wantEnv)) {
+				t.Errorf("sidecar env = %v, want %v", sidecar.Env, tt.wantEnv)
+			}
+
+			if patched.Spec.ShareProcessNamespace == nil || !*patched.Spec.ShareProcessNamespace {
+				t.Errorf("shareProcessNamespace not set")
+			}
+			for _, c := range append(patched.Spec.Containers, patched.Spec.InitContainers...) {
+				// the limits are the requests, so the pod is Guaranteed.
+				if c.Resources.Requests != nil && !equality.Semantic.DeepEqual(c.Resources.Requests, c.Resources.Limits) {
+					t.Errorf("container %s limits = %v, want the requests %v", c.Name, c.Resources.Limits, c.Resources.Requests)
+				}
+				// the resize policy can only be set on the containers and the native sidecars.
+				resizable := c.Name != "migrate"
+				if resizable && !equality.Semantic.DeepEqual(c.ResizePolicy, notRequired) && c.Name != ContainerName {
+					t.Errorf("container %s resize policy = %v, want %v", c.Name, c.ResizePolicy, notRequired)
+				}
+				if !resizable && c.ResizePolicy != nil {
+					t.Errorf("init container %s resize policy = %v, want none", c.Name, c.ResizePolicy)
+				}
+			}
+
+			if len(resp.Warnings) != len(tt.wantWarnings) {
+				t.Fatalf("warnings = %v, want %v", resp.Warnings, tt.wantWarnings)
+			}
+			for idx, w := range tt.wantWarnings {
+				if !strings.Contains(resp.Warnings[idx], w) {
+					t.Errorf("warning = %q, want %q", resp.Warnings[idx], w)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchOpsKeepsExistingFields(t *testing.T) {
+	app := container("app", "100m", "100M", false)
+	// the limit above the request is set to the request, the other limit is kept.
+	app.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}
+	app.ResizePolicy = []corev1.ContainerResizePolicy{{ResourceName: corev1.ResourceMemory, RestartPolicy: corev1.RestartContainer}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{controller.EnabledKey: "true"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{app}},
+	}
+
+	_, patched := review(t, &Injector{}, pod)
+	if patched == nil {
+		t.Fatalf("sidecar not injected")
+	}
+
+	c := patched.Spec.Containers[0]
+	if cpu := c.Resources.Limits[corev1.ResourceCPU]; cpu.String() != "100m" {
+		t.Errorf("cpu limit = %s, want 100m", cpu.String())
+	}
+	if memory := c.Resources.Limits[corev1.ResourceMemory]; memory.String() != "100M" {
+		t.Errorf("memory limit = %s, want 100M", memory.String())
+	}
+	want := []corev1.ContainerResizePolicy{
+		{ResourceName: corev1.ResourceMemory, RestartPolicy: corev1.RestartContainer},
+		{ResourceName: corev1.ResourceCPU, RestartPolicy: corev1.NotRequired},
+	}
+	if !equality.Semantic.DeepEqual(c.ResizePolicy, want) {
+		t.Errorf("resize policy = %v, want %v", c.ResizePolicy, want)
+	}
+}